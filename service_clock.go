@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type ClockTimer interface {
+	Stop() bool
+}
+
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) ClockTimer
+}
+
+type SystemClock struct {
+}
+
+func GetSystemClock() Clock {
+	return &SystemClock{}
+}
+
+func (*SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (*SystemClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	return time.AfterFunc(d, f)
+}
+
+// FakeClock only moves when told to. Timers due within an Advance call are
+// fired synchronously, in order, on the goroutine calling Advance. Timers
+// created already due fire right away on a new goroutine, like time.AfterFunc.
+type FakeClock struct {
+	_lock   sync.Mutex
+	_now    time.Time
+	_seq    int
+	_timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	_clock *FakeClock
+	_at    time.Time
+	_seq   int
+	_f     func()
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{_now: now}
+}
+
+func (clock *FakeClock) Now() time.Time {
+	clock._lock.Lock()
+	defer clock._lock.Unlock()
+	return clock._now
+}
+
+func (clock *FakeClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	clock._lock.Lock()
+	defer clock._lock.Unlock()
+	clock._seq++
+	timer := &fakeTimer{_clock: clock, _at: clock._now.Add(d), _seq: clock._seq, _f: f}
+	if d <= 0 {
+		go f()
+		return timer
+	}
+	clock._timers = append(clock._timers, timer)
+	sort.SliceStable(clock._timers, func(i, j int) bool {
+		a, b := clock._timers[i], clock._timers[j]
+		if a._at.Equal(b._at) {
+			return a._seq < b._seq
+		}
+		return a._at.Before(b._at)
+	})
+	return timer
+}
+
+func (clock *FakeClock) Advance(d time.Duration) {
+	clock._lock.Lock()
+	target := clock._now.Add(d)
+	clock._lock.Unlock()
+	clock.Set(target)
+}
+
+func (clock *FakeClock) Set(target time.Time) {
+	for {
+		clock._lock.Lock()
+		if len(clock._timers) == 0 || clock._timers[0]._at.After(target) {
+			if target.After(clock._now) {
+				clock._now = target
+			}
+			clock._lock.Unlock()
+			return
+		}
+		timer := clock._timers[0]
+		clock._timers = clock._timers[1:]
+		if timer._at.After(clock._now) {
+			clock._now = timer._at
+		}
+		clock._lock.Unlock()
+		timer._f()
+	}
+}
+
+func (clock *FakeClock) PendingTimers() int {
+	clock._lock.Lock()
+	defer clock._lock.Unlock()
+	return len(clock._timers)
+}
+
+func (timer *fakeTimer) Stop() bool {
+	clock := timer._clock
+	clock._lock.Lock()
+	defer clock._lock.Unlock()
+	for i := range clock._timers {
+		if clock._timers[i] == timer {
+			clock._timers = append(clock._timers[:i], clock._timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// sleepContext waits for d on the given clock, returning early with the
+// context error when ctx is done first.
+func sleepContext(ctx context.Context, clock Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	elapsed := make(chan struct{})
+	timer := clock.AfterFunc(d, func() { close(elapsed) })
+	select {
+	case <-elapsed:
+		return nil
+	case <-ctx.Done():
+		timer.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClockFiresTimersInOrder(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	fired := []int{}
+	clock.AfterFunc(2*time.Second, func() { fired = append(fired, 2) })
+	clock.AfterFunc(1*time.Second, func() { fired = append(fired, 1) })
+	stopped := clock.AfterFunc(3*time.Second, func() { fired = append(fired, 3) })
+
+	assert.True(t, stopped.Stop())
+	clock.Advance(time.Second)
+	assert.Equal(t, []int{1}, fired)
+	clock.Advance(time.Minute)
+	assert.Equal(t, []int{1, 2}, fired)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 1, 1, 0, time.UTC), clock.Now())
+	assert.Zero(t, clock.PendingTimers())
+}
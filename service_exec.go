@@ -1,48 +1,306 @@
 package utils
 
 import (
-	"fmt"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
 	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
+// execCancelWaitDelay bounds how long a cancelled command may keep its
+// output pipes open, e.g. through orphaned grandchildren.
+const execCancelWaitDelay = 5 * time.Second
+
 type ExecResult struct {
 	ExitCode  int
 	Error     error
 	Output    []byte
+	Stdout    []byte
+	Stderr    []byte
+	Truncated bool
 	HasErrors bool
+	TimedOut  bool
+	Stages    []*ExecResult
+	Attempts  []*ExecResult
+}
+
+// ExecServiceOptions.OutputLimit caps, in bytes, how much of each of
+// stdout, stderr and the combined output is kept. 0 keeps everything.
+type ExecServiceOptions struct {
+	OutputLimit int
+}
+
+// ExecOptions configures a single command run. Env and ExtraEnv are added
+// to the parent process environment unless ReplaceEnv is set. The command
+// reads Stdin, or else StdinBytes or StdinString. User may be a user name
+// or a numeric uid. Umask 0 keeps the inherited umask; any other value runs
+// the command through sh to set it. Timeout and OutputLimit apply in
+// addition to the context and service-wide limits.
+type ExecOptions struct {
+	Dir         string
+	Env         []string
+	ExtraEnv    map[string]string
+	ReplaceEnv  bool
+	Stdin       io.Reader
+	StdinBytes  []byte
+	StdinString string
+	Stdout      io.Writer
+	Stderr      io.Writer
+	Timeout     time.Duration
+	User        string
+	Umask       os.FileMode
+	OutputLimit int
+	WaitDelay   time.Duration
+	Retry       *ExecRetryPolicy
 }
 
 type ExecService interface {
-	RunCmd(program string, args []string, options ...*exec.Cmd) *ExecResult
+	RunCmd(program string, args []string, options ...ExecOptions) *ExecResult
+	RunCmdContext(ctx context.Context, program string, args []string, options ...ExecOptions) *ExecResult
+	RunPipeline(commands []Command, options ...ExecOptions) *ExecResult
+	RunPipelineContext(ctx context.Context, commands []Command, options ...ExecOptions) *ExecResult
+	Start(program string, args []string, options ...ExecOptions) (*Process, error)
+	Processes() []*Process
+	StopAll(grace time.Duration) error
 }
 
 type DefaultExecService struct {
+	_lock        sync.Mutex
+	_outputLimit int
+	_processes   []*Process
+}
+
+func GetExecService(options ...ExecServiceOptions) ExecService {
+	service := &DefaultExecService{}
+	if len(options) > 0 {
+		service._outputLimit = options[0].OutputLimit
+	}
+	return service
 }
 
-func GetExecService() ExecService {
-	return &DefaultExecService{}
+func (service *DefaultExecService) RunCmd(program string, args []string, options ...ExecOptions) *ExecResult {
+	return service.RunCmdContext(context.Background(), program, args, options...)
 }
 
-func (*DefaultExecService) RunCmd(program string, args []string, options ...*exec.Cmd) *ExecResult {
-	cmd := exec.Command(program, args...)
+// RunCmdContext runs a command until it exits or ctx is done. A command
+// with a cancellable ctx runs in its own process group, which is killed as
+// a whole on cancellation, and the output captured so far is returned.
+func (service *DefaultExecService) RunCmdContext(ctx context.Context, program string, args []string, options ...ExecOptions) *ExecResult {
+	opts := ExecOptions{}
 	if len(options) > 0 {
-		opt := options[0]
-		cmd.Dir = opt.Dir
-		cmd.Env = opt.Env
-		cmd.WaitDelay = opt.WaitDelay
+		opts = options[0]
+	}
+	return retryExec(ctx, opts, func(opts ExecOptions) *ExecResult {
+		return service.run(ctx, program, args, opts)
+	})
+}
+
+func (service *DefaultExecService) run(ctx context.Context, program string, args []string, opts ExecOptions) *ExecResult {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	cmd, err := command(ctx, program, args, opts)
+	if err != nil {
+		return &ExecResult{ExitCode: -1, Error: &ExecError{Program: program, Args: args, ExitCode: -1, Err: err}, HasErrors: true}
+	}
+
+	output := service.capture(opts)
+	stdout := &execStream{_capture: output, _buffer: &output._stdout, _forward: opts.Stdout}
+	stderr := &execStream{_capture: output, _buffer: &output._stderr, _forward: opts.Stderr}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if stdin := opts.stdin(); stdin != nil {
+		feedStdin(cmd, stdin)
+	}
+	started := time.Now()
+	err = cmd.Run()
+	stdout.Flush()
+	stderr.Flush()
+	return execResult(ctx, program, args, cmd, err, output, started)
+}
+
+// command prepares a command as configured by opts, apart from its input
+// and output.
+func command(ctx context.Context, program string, args []string, opts ExecOptions) (*exec.Cmd, error) {
+	if opts.Umask != 0 {
+		var err error
+		if program, args, err = withUmask(program, args, opts.Umask, opts.Dir); err != nil {
+			return nil, err
+		}
+	}
+	cmd := exec.CommandContext(ctx, program, args...)
+	cmd.Dir = opts.Dir
+	cmd.Env = execEnv(opts)
+	cmd.WaitDelay = opts.WaitDelay
+	if ctx.Done() != nil {
+		if cmd.WaitDelay == 0 {
+			cmd.WaitDelay = execCancelWaitDelay
+		}
+		killProcessGroupOnCancel(cmd)
+	}
+	if opts.User != "" {
+		if err := runAsUser(cmd, opts.User); err != nil {
+			return nil, err
+		}
+	}
+	return cmd, nil
+}
+
+func (service *DefaultExecService) capture(opts ExecOptions) *execCapture {
+	output := &execCapture{_limit: service._outputLimit}
+	if opts.OutputLimit > 0 && (output._limit <= 0 || opts.OutputLimit < output._limit) {
+		output._limit = opts.OutputLimit
+	}
+	return output
+}
+
+// execResult describes a command that has been waited for, given the error
+// returned by Run or Wait.
+func execResult(ctx context.Context, program string, args []string, cmd *exec.Cmd, err error, output *execCapture, started time.Time) *ExecResult {
+	result := &ExecResult{
+		ExitCode:  -1,
+		Output:    output._combined.Bytes(),
+		Stdout:    output._stdout.Bytes(),
+		Stderr:    output._stderr.Bytes(),
+		Truncated: output._truncated,
+		TimedOut:  errors.Is(ctx.Err(), context.DeadlineExceeded),
+	}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
 	}
+	success := cmd.ProcessState != nil && cmd.ProcessState.Success()
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil || !success {
+		result.Error = &ExecError{
+			Program:  program,
+			Args:     args,
+			ExitCode: result.ExitCode,
+			Signal:   execSignal(cmd.ProcessState),
+			Duration: time.Since(started),
+			Stderr:   execErrorStderr(result.Stderr),
+			Err:      err,
+		}
+	}
+	result.HasErrors = result.Error != nil
+	return result
+}
+
+// execEnv returns the environment for the command, or nil to inherit the
+// parent environment unchanged.
+func execEnv(opts ExecOptions) []string {
+	if !opts.ReplaceEnv && len(opts.Env) == 0 && len(opts.ExtraEnv) == 0 {
+		return nil
+	}
+	env := []string{}
+	if !opts.ReplaceEnv {
+		env = append(env, os.Environ()...)
+	}
+	env = append(env, opts.Env...)
+	keys := make([]string, 0, len(opts.ExtraEnv))
+	for key := range opts.ExtraEnv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+opts.ExtraEnv[key])
+	}
+	return env
+}
 
-	output, err := cmd.CombinedOutput()
-	success := cmd.ProcessState.Success()
-	if err == nil && !success {
-		err = fmt.Errorf("program exited with error code %d and output '%s'", 
-			cmd.ProcessState.ExitCode(),
-			string(output))
+// stdin returns the input given in the options, if any.
+func (opts ExecOptions) stdin() io.Reader {
+	if opts.Stdin != nil {
+		return opts.Stdin
+	} else if opts.StdinBytes != nil {
+		return bytes.NewReader(opts.StdinBytes)
+	} else if opts.StdinString != "" {
+		return strings.NewReader(opts.StdinString)
 	}
-	return &ExecResult{
-		ExitCode:  cmd.ProcessState.ExitCode(),
-		Error:     err,
-		Output:    output,
-		HasErrors: !success || err != nil,
+	return nil
+}
+
+// feedStdin copies stdin to the command from a goroutine that Wait does
+// not wait for, so a reader that blocks cannot keep a stopped command from
+// returning. Files are handed to the command as they are.
+func feedStdin(cmd *exec.Cmd, stdin io.Reader) {
+	if _, ok := stdin.(*os.File); ok {
+		cmd.Stdin = stdin
+		return
+	}
+	pipe, err := cmd.StdinPipe()
+	if err != nil {
+		return
+	}
+	go func() {
+		io.Copy(pipe, stdin)
+		pipe.Close()
+	}()
+}
+
+// execCapture collects stdout and stderr separately and interleaved, as
+// the command writes them.
+type execCapture struct {
+	_lock      sync.Mutex
+	_forward   sync.Mutex
+	_limit     int
+	_combined  bytes.Buffer
+	_stdout    bytes.Buffer
+	_stderr    bytes.Buffer
+	_truncated bool
+}
+
+// execStream captures one of the command's output streams and copies it,
+// as it arrives, to the writer given in the options.
+type execStream struct {
+	_capture *execCapture
+	_buffer  *bytes.Buffer
+	_forward io.Writer
+}
+
+func (stream *execStream) Write(p []byte) (int, error) {
+	capture := stream._capture
+	capture._lock.Lock()
+	capture.append(stream._buffer, p)
+	capture.append(&capture._combined, p)
+	capture._lock.Unlock()
+	if stream._forward != nil {
+		// Both streams may forward to the same writer, from the separate
+		// goroutines copying them.
+		capture._forward.Lock()
+		stream._forward.Write(p)
+		capture._forward.Unlock()
+	}
+	return len(p), nil
+}
+
+// Flush flushes the forwarded writer, if it buffers.
+func (stream *execStream) Flush() error {
+	if flusher, ok := stream._forward.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+func (capture *execCapture) snapshot(buffer *bytes.Buffer) []byte {
+	capture._lock.Lock()
+	defer capture._lock.Unlock()
+	return append([]byte{}, buffer.Bytes()...)
+}
+
+func (capture *execCapture) append(buffer *bytes.Buffer, p []byte) {
+	if capture._limit > 0 && buffer.Len()+len(p) > capture._limit {
+		p = p[:capture._limit-buffer.Len()]
+		capture._truncated = true
 	}
+	buffer.Write(p)
 }
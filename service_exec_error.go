@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// execErrorStderrLimit caps how much of the end of stderr an ExecError keeps.
+const execErrorStderrLimit = 1024
+
+// ExecError describes a command that failed to start, exited unsuccessfully
+// or was stopped. Its message names the program and how it failed, but not
+// its output, which is kept in Stderr for logging.
+type ExecError struct {
+	Program  string
+	Args     []string
+	ExitCode int
+	Signal   os.Signal
+	Duration time.Duration
+	Stderr   string
+	Err      error
+}
+
+func (err *ExecError) Error() string {
+	switch {
+	case errors.Is(err.Err, context.Canceled) || errors.Is(err.Err, context.DeadlineExceeded):
+		return fmt.Sprintf("program '%s' was stopped: %v", err.Program, err.Err)
+	case err.Signal != nil:
+		return fmt.Sprintf("program '%s' was killed by signal: %v", err.Program, err.Signal)
+	case err.ExitCode > 0:
+		return fmt.Sprintf("program '%s' exited with error code %d", err.Program, err.ExitCode)
+	case err.Err != nil:
+		return fmt.Sprintf("program '%s' failed: %v", err.Program, err.Err)
+	}
+	return fmt.Sprintf("program '%s' failed", err.Program)
+}
+
+func (err *ExecError) Unwrap() error {
+	return err.Err
+}
+
+func IsExecError(err error) bool {
+	var execErr *ExecError
+	return errors.As(err, &execErr)
+}
+
+// ExecBusinessError turns a command failure into a BusinessError whose code
+// is looked up by exit code in codes, or is fallback for other exit codes
+// when given. Other errors are returned unchanged. The BusinessError has no
+// detail, so no command output ends up in messages shown to users.
+func ExecBusinessError(err error, codes map[int]string, fallback ...string) error {
+	var execErr *ExecError
+	if !errors.As(err, &execErr) {
+		return err
+	}
+	if code, ok := codes[execErr.ExitCode]; ok {
+		return NewBusinessError(code)
+	} else if len(fallback) > 0 {
+		return NewBusinessError(fallback[0])
+	}
+	return err
+}
+
+func execErrorStderr(stderr []byte) string {
+	if len(stderr) <= execErrorStderrLimit {
+		return string(stderr)
+	}
+	return "..." + strings.ToValidUTF8(string(stderr[len(stderr)-execErrorStderrLimit:]), "")
+}
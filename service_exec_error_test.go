@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecError(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunCmd("sh", []string{"-c", "echo secret-token >&2; exit 3"})
+
+	var execErr *ExecError
+	assert.True(t, errors.As(res.Error, &execErr))
+	assert.True(t, IsExecError(res.Error))
+	assert.Equal(t, "sh", execErr.Program)
+	assert.Equal(t, []string{"-c", "echo secret-token >&2; exit 3"}, execErr.Args)
+	assert.Equal(t, 3, execErr.ExitCode)
+	assert.Nil(t, execErr.Signal)
+	assert.Greater(t, execErr.Duration, time.Duration(0))
+	assert.Equal(t, "secret-token\n", execErr.Stderr)
+	assert.Equal(t, "program 'sh' exited with error code 3", execErr.Error())
+
+	var exitErr *exec.ExitError
+	assert.True(t, errors.As(res.Error, &exitErr))
+}
+
+func TestExecErrorSignal(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunCmd("sh", []string{"-c", "kill -9 $$"})
+
+	var execErr *ExecError
+	assert.True(t, errors.As(res.Error, &execErr))
+	assert.NotNil(t, execErr.Signal)
+	assert.Equal(t, "program 'sh' was killed by signal: killed", execErr.Error())
+}
+
+func TestExecErrorStderrTruncated(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunCmd("sh", []string{"-c", "head -c 5000 /dev/zero | tr '\\0' a >&2; echo END >&2; exit 1"})
+
+	var execErr *ExecError
+	assert.True(t, errors.As(res.Error, &execErr))
+	assert.Len(t, execErr.Stderr, execErrorStderrLimit+3)
+	assert.True(t, strings.HasPrefix(execErr.Stderr, "..."))
+	assert.True(t, strings.HasSuffix(execErr.Stderr, "END\n"))
+}
+
+func TestExecErrorMissingProgram(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunCmd("go_utils_no_such_program", []string{})
+
+	var execErr *ExecError
+	assert.True(t, errors.As(res.Error, &execErr))
+	assert.Equal(t, -1, execErr.ExitCode)
+	assert.True(t, errors.Is(res.Error, exec.ErrNotFound))
+	assert.True(t, strings.HasPrefix(execErr.Error(), "program 'go_utils_no_such_program' failed: "))
+}
+
+func TestExecBusinessError(t *testing.T) {
+	var service = GetExecService()
+	codes := map[int]string{2: "FILE_NOT_FOUND", 5: "ACCESS_DENIED"}
+
+	res := service.RunCmd("sh", []string{"-c", "echo /srv/private/key >&2; exit 2"})
+	err := ExecBusinessError(res.Error, codes)
+	assert.True(t, IsBusinessError(err))
+	assert.Equal(t, "FILE_NOT_FOUND", err.Error())
+
+	res = service.RunCmd("sh", []string{"-c", "exit 9"})
+	assert.Same(t, res.Error, ExecBusinessError(res.Error, codes))
+	assert.Equal(t, "COMMAND_FAILED", ExecBusinessError(res.Error, codes, "COMMAND_FAILED").Error())
+
+	other := errors.New("other")
+	assert.Same(t, other, ExecBusinessError(other, codes, "COMMAND_FAILED"))
+	assert.Nil(t, ExecBusinessError(nil, codes, "COMMAND_FAILED"))
+}
+
+func TestFakeExecError(t *testing.T) {
+	fake := NewFakeExecService(t)
+	fake.Expect("curl").AnyArgs().Return(ExecResult{ExitCode: 6, HasErrors: true, Stderr: []byte("could not resolve host")})
+
+	res := fake.RunCmd("curl", []string{"https://example.invalid"})
+	var execErr *ExecError
+	assert.True(t, errors.As(res.Error, &execErr))
+	assert.Equal(t, 6, execErr.ExitCode)
+	assert.Equal(t, []string{"https://example.invalid"}, execErr.Args)
+	assert.Equal(t, "could not resolve host", execErr.Stderr)
+}
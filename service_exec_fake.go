@@ -0,0 +1,296 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeExecTestingT is satisfied by *testing.T.
+type FakeExecTestingT interface {
+	Errorf(format string, args ...any)
+}
+
+type ExecCall struct {
+	Program string
+	Args    []string
+	Options ExecOptions
+	Stdin   []byte
+}
+
+// FakeExecService is an ExecService for tests. Commands are matched against
+// the registered expectations in order and answered with canned results
+// instead of being run. Every call is recorded, and calls that match no
+// expectation fail with exit code -1 and are reported to t, when given.
+type FakeExecService struct {
+	_lock         sync.Mutex
+	_t            FakeExecTestingT
+	_expectations []*FakeExecExpectation
+	_calls        []ExecCall
+	_unexpected   []ExecCall
+}
+
+type FakeExecExpectation struct {
+	_program string
+	_args    []string
+	_anyArgs bool
+	_result  ExecResult
+	_times   int
+	_calls   int
+}
+
+func NewFakeExecService(t ...FakeExecTestingT) *FakeExecService {
+	fake := &FakeExecService{}
+	if len(t) > 0 {
+		fake._t = t[0]
+	}
+	return fake
+}
+
+// Expect registers a command with exactly the given arguments. Unless
+// limited with Times, it matches any number of calls.
+func (fake *FakeExecService) Expect(program string, args ...string) *FakeExecExpectation {
+	fake._lock.Lock()
+	defer fake._lock.Unlock()
+	expectation := &FakeExecExpectation{_program: program, _args: args}
+	fake._expectations = append(fake._expectations, expectation)
+	return expectation
+}
+
+func (expectation *FakeExecExpectation) AnyArgs() *FakeExecExpectation {
+	expectation._anyArgs = true
+	return expectation
+}
+
+// Return answers with result. A result with HasErrors but no Error gets an
+// *ExecError like a real failed command would.
+func (expectation *FakeExecExpectation) Return(result ExecResult) *FakeExecExpectation {
+	expectation._result = result
+	return expectation
+}
+
+// ReturnOutput answers with the given stdout and exit code.
+func (expectation *FakeExecExpectation) ReturnOutput(stdout string, exitCode int) *FakeExecExpectation {
+	result := ExecResult{ExitCode: exitCode, Output: []byte(stdout), Stdout: []byte(stdout), HasErrors: exitCode != 0}
+	return expectation.Return(result)
+}
+
+func (expectation *FakeExecExpectation) Times(n int) *FakeExecExpectation {
+	expectation._times = n
+	return expectation
+}
+
+func (expectation *FakeExecExpectation) Once() *FakeExecExpectation {
+	return expectation.Times(1)
+}
+
+func (expectation *FakeExecExpectation) String() string {
+	if expectation._anyArgs {
+		return expectation._program + " ..."
+	}
+	return strings.TrimSpace(expectation._program + " " + strings.Join(expectation._args, " "))
+}
+
+func (expectation *FakeExecExpectation) matches(program string, args []string) bool {
+	if program != expectation._program || (expectation._times > 0 && expectation._calls >= expectation._times) {
+		return false
+	} else if expectation._anyArgs {
+		return true
+	} else if len(args) != len(expectation._args) {
+		return false
+	}
+	for i := range args {
+		if args[i] != expectation._args[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Calls returns every command run so far, in order.
+func (fake *FakeExecService) Calls() []ExecCall {
+	fake._lock.Lock()
+	defer fake._lock.Unlock()
+	return append([]ExecCall{}, fake._calls...)
+}
+
+// Verify reports expectations that were never met and calls that matched
+// no expectation.
+func (fake *FakeExecService) Verify() error {
+	fake._lock.Lock()
+	defer fake._lock.Unlock()
+	problems := []string{}
+	for _, expectation := range fake._expectations {
+		if expectation._calls == 0 || expectation._calls < expectation._times {
+			problems = append(problems, fmt.Sprintf("expected '%s' to run %s, ran %d times",
+				expectation, fakeExecTimes(expectation._times), expectation._calls))
+		}
+	}
+	for _, call := range fake._unexpected {
+		problems = append(problems, fmt.Sprintf("unexpected command '%s'", fakeExecCommandLine(call.Program, call.Args)))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(problems, "; "))
+}
+
+func (fake *FakeExecService) RunCmd(program string, args []string, options ...ExecOptions) *ExecResult {
+	return fake.RunCmdContext(context.Background(), program, args, options...)
+}
+
+func (fake *FakeExecService) RunCmdContext(ctx context.Context, program string, args []string, options ...ExecOptions) *ExecResult {
+	opts := ExecOptions{}
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	return retryExec(ctx, opts, func(opts ExecOptions) *ExecResult {
+		result, _ := fake.run(ctx, program, args, opts, opts.stdin())
+		return result
+	})
+}
+
+func (fake *FakeExecService) RunPipeline(commands []Command, options ...ExecOptions) *ExecResult {
+	return fake.RunPipelineContext(context.Background(), commands, options...)
+}
+
+// RunPipelineContext answers each stage on its own, feeding it the previous
+// stage's canned stdout, and combines the results like a real pipeline.
+func (fake *FakeExecService) RunPipelineContext(ctx context.Context, commands []Command, options ...ExecOptions) *ExecResult {
+	if len(commands) == 0 {
+		return &ExecResult{ExitCode: -1, Error: fmt.Errorf("pipeline has no commands"), HasErrors: true}
+	}
+	opts := ExecOptions{}
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	return retryExec(ctx, opts, func(opts ExecOptions) *ExecResult {
+		return fake.runPipeline(ctx, commands, opts)
+	})
+}
+
+func (fake *FakeExecService) runPipeline(ctx context.Context, commands []Command, opts ExecOptions) *ExecResult {
+	stageOpts := opts
+	stageOpts.Stdout = nil
+	stageOpts.Stderr = nil
+	result := &ExecResult{}
+	stdin := opts.stdin()
+	for i, c := range commands {
+		stage, _ := fake.run(ctx, c.Program, c.Args, stageOpts, stdin)
+		stdin = strings.NewReader(string(stage.Stdout))
+		result.Stages = append(result.Stages, stage)
+		result.Stderr = append(result.Stderr, stage.Stderr...)
+		if i == len(commands)-1 {
+			result.Stdout = stage.Stdout
+		}
+		if stage.HasErrors {
+			result.ExitCode = stage.ExitCode
+			result.Error = stage.Error
+			result.HasErrors = true
+		}
+		result.TimedOut = result.TimedOut || stage.TimedOut
+	}
+	result.Output = append(append([]byte{}, result.Stdout...), result.Stderr...)
+	fakeExecForward(opts.Stdout, result.Stdout)
+	fakeExecForward(opts.Stderr, result.Stderr)
+	return result
+}
+
+// Start answers like RunCmd and returns a process that has already exited
+// with the canned result. Commands matching no expectation fail to start.
+func (fake *FakeExecService) Start(program string, args []string, options ...ExecOptions) (*Process, error) {
+	opts := ExecOptions{}
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	result, expected := fake.run(context.Background(), program, args, opts, opts.stdin())
+	if !expected {
+		return nil, result.Error
+	}
+	return finishedProcess(program, args, result), nil
+}
+
+// Processes returns no processes, as fake ones exit as soon as started.
+func (fake *FakeExecService) Processes() []*Process {
+	return []*Process{}
+}
+
+func (fake *FakeExecService) StopAll(grace time.Duration) error {
+	return nil
+}
+
+// run answers a command and tells whether it matched an expectation.
+func (fake *FakeExecService) run(ctx context.Context, program string, args []string, opts ExecOptions, stdin io.Reader) (*ExecResult, bool) {
+	call := ExecCall{Program: program, Args: append([]string{}, args...), Options: opts}
+	if stdin != nil {
+		call.Stdin, _ = io.ReadAll(stdin)
+	}
+	fake._lock.Lock()
+	fake._calls = append(fake._calls, call)
+	var found *FakeExecExpectation
+	for _, expectation := range fake._expectations {
+		if expectation.matches(program, args) {
+			found = expectation
+			break
+		}
+	}
+	var result ExecResult
+	if found != nil {
+		found._calls++
+		result = found._result
+	} else {
+		fake._unexpected = append(fake._unexpected, call)
+	}
+	t := fake._t
+	fake._lock.Unlock()
+
+	if found == nil {
+		line := fakeExecCommandLine(program, args)
+		if t != nil {
+			t.Errorf("unexpected command '%s'", line)
+		}
+		err := &ExecError{Program: program, Args: call.Args, ExitCode: -1, Err: fmt.Errorf("unexpected command '%s'", line)}
+		return &ExecResult{ExitCode: -1, Error: err, HasErrors: true}, false
+	} else if ctx.Err() != nil {
+		err := &ExecError{Program: program, Args: call.Args, ExitCode: -1, Err: ctx.Err()}
+		return &ExecResult{ExitCode: -1, Error: err, HasErrors: true, TimedOut: ctx.Err() == context.DeadlineExceeded}, true
+	} else if result.HasErrors && result.Error == nil {
+		result.Error = &ExecError{
+			Program:  program,
+			Args:     call.Args,
+			ExitCode: result.ExitCode,
+			Stderr:   execErrorStderr(result.Stderr),
+		}
+	}
+	fakeExecForward(opts.Stdout, result.Stdout)
+	fakeExecForward(opts.Stderr, result.Stderr)
+	return &result, true
+}
+
+func fakeExecForward(w io.Writer, p []byte) {
+	if w == nil {
+		return
+	}
+	if len(p) > 0 {
+		w.Write(p)
+	}
+	if flusher, ok := w.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+}
+
+func fakeExecCommandLine(program string, args []string) string {
+	return strings.TrimSpace(program + " " + strings.Join(args, " "))
+}
+
+func fakeExecTimes(n int) string {
+	if n == 0 {
+		return "at least once"
+	} else if n == 1 {
+		return "once"
+	}
+	return fmt.Sprintf("%d times", n)
+}
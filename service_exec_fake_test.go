@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeExecRecorder struct {
+	errors []string
+}
+
+func (recorder *fakeExecRecorder) Errorf(format string, args ...any) {
+	recorder.errors = append(recorder.errors, fmt.Sprintf(format, args...))
+}
+
+func TestFakeExec(t *testing.T) {
+	fake := NewFakeExecService(t)
+	fake.Expect("git", "rev-parse", "HEAD").ReturnOutput("abc123\n", 0)
+	fake.Expect("git").AnyArgs().ReturnOutput("", 1).Once()
+
+	var service ExecService = fake
+	res := service.RunCmd("git", []string{"rev-parse", "HEAD"}, ExecOptions{Dir: "/repo"})
+	assert.Nil(t, res.Error)
+	assert.Equal(t, "abc123\n", string(res.Stdout))
+
+	res = service.RunCmd("git", []string{"fetch"})
+	assert.True(t, res.HasErrors)
+	assert.Equal(t, 1, res.ExitCode)
+
+	calls := fake.Calls()
+	assert.Len(t, calls, 2)
+	assert.Equal(t, []string{"rev-parse", "HEAD"}, calls[0].Args)
+	assert.Equal(t, "/repo", calls[0].Options.Dir)
+	assert.Nil(t, fake.Verify())
+}
+
+func TestFakeExecUnexpected(t *testing.T) {
+	recorder := &fakeExecRecorder{}
+	fake := NewFakeExecService(recorder)
+	fake.Expect("ls").Once()
+	fake.Expect("rm", "-rf", "/tmp/x")
+
+	fake.RunCmd("ls", []string{})
+	res := fake.RunCmd("ls", []string{})
+
+	assert.True(t, res.HasErrors)
+	assert.Equal(t, -1, res.ExitCode)
+	assert.True(t, IsExecError(res.Error))
+	assert.Contains(t, res.Error.Error(), "unexpected command 'ls'")
+	assert.Equal(t, []string{"unexpected command 'ls'"}, recorder.errors)
+	err := fake.Verify()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "expected 'rm -rf /tmp/x' to run at least once, ran 0 times")
+	assert.Contains(t, err.Error(), "unexpected command 'ls'")
+}
+
+func TestFakeExecStdinAndStreams(t *testing.T) {
+	fake := NewFakeExecService(t)
+	fake.Expect("psql").Return(ExecResult{Stdout: []byte("1\n2"), Stderr: []byte("notice\n")})
+
+	lines := []string{}
+	var stderr bytes.Buffer
+	fake.RunCmd("psql", []string{}, ExecOptions{
+		Stdin:  strings.NewReader("select 1;"),
+		Stdout: NewExecLineWriter(func(line string) { lines = append(lines, line) }),
+		Stderr: &stderr,
+	})
+
+	assert.Equal(t, "select 1;", string(fake.Calls()[0].Stdin))
+	assert.Equal(t, []string{"1", "2"}, lines)
+	assert.Equal(t, "notice\n", stderr.String())
+}
+
+func TestFakeExecPipeline(t *testing.T) {
+	fake := NewFakeExecService(t)
+	fake.Expect("cat", "log").ReturnOutput("b\na\n", 0)
+	fake.Expect("sort").ReturnOutput("a\nb\n", 0)
+
+	res := fake.RunPipeline([]Command{{Program: "cat", Args: []string{"log"}}, {Program: "sort"}})
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, "a\nb\n", string(res.Stdout))
+	assert.Len(t, res.Stages, 2)
+	assert.Equal(t, "b\na\n", string(fake.Calls()[1].Stdin))
+	assert.Nil(t, fake.Verify())
+}
+
+func TestFakeExecStart(t *testing.T) {
+	recorder := &fakeExecRecorder{}
+	fake := NewFakeExecService(recorder)
+	fake.Expect("redis-server").ReturnOutput("ready\n", 0)
+
+	process, err := fake.Start("redis-server", []string{})
+	assert.Nil(t, err)
+	assert.Equal(t, "ready\n", string(process.Stdout()))
+	assert.Equal(t, 0, process.Wait().ExitCode)
+	assert.Nil(t, process.Stop(0))
+	assert.Empty(t, fake.Processes())
+
+	_, err = fake.Start("memcached", []string{})
+	assert.NotNil(t, err)
+	assert.Len(t, recorder.errors, 1)
+}
@@ -0,0 +1,36 @@
+//go:build !unix
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// killProcessGroupOnCancel keeps the default behaviour of killing only the
+// started process, as process groups are not available on this platform.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+}
+
+func runAsUser(cmd *exec.Cmd, name string) error {
+	return fmt.Errorf("running as user '%s' is not supported on this platform", name)
+}
+
+// withUmask leaves the command unchanged, as umasks are not available on
+// this platform.
+func withUmask(program string, args []string, umask os.FileMode, dir string) (string, []string, error) {
+	return program, args, nil
+}
+
+// terminateProcessGroup kills the command, as it cannot be asked to
+// terminate on this platform.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// execSignal returns nil, as processes are not killed by signals on this
+// platform.
+func execSignal(state *os.ProcessState) os.Signal {
+	return nil
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Command is one stage of a pipeline.
+type Command struct {
+	Program string
+	Args    []string
+}
+
+func (service *DefaultExecService) RunPipeline(commands []Command, options ...ExecOptions) *ExecResult {
+	return service.RunPipelineContext(context.Background(), commands, options...)
+}
+
+// RunPipelineContext runs commands as in "a | b | c", each reading the
+// previous one's stdout. The options apply to every stage, with Stdin going
+// to the first and Stdout coming from the last. Like with pipefail, the
+// pipeline fails with the exit code of the last stage that failed, and each
+// stage's own result is kept in Stages.
+func (service *DefaultExecService) RunPipelineContext(ctx context.Context, commands []Command, options ...ExecOptions) *ExecResult {
+	if len(commands) == 0 {
+		return &ExecResult{ExitCode: -1, Error: fmt.Errorf("pipeline has no commands"), HasErrors: true}
+	}
+	opts := ExecOptions{}
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	return retryExec(ctx, opts, func(opts ExecOptions) *ExecResult {
+		return service.runPipeline(ctx, commands, opts)
+	})
+}
+
+func (service *DefaultExecService) runPipeline(ctx context.Context, commands []Command, opts ExecOptions) *ExecResult {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	output := service.capture(opts)
+	stdout := &execStream{_capture: output, _buffer: &output._stdout, _forward: opts.Stdout}
+	stderr := &execStream{_capture: output, _buffer: &output._stderr, _forward: opts.Stderr}
+	cmds := make([]*exec.Cmd, len(commands))
+	outputs := make([]*execCapture, len(commands))
+	errs := make([]error, len(commands))
+	starts := make([]time.Time, len(commands))
+	var reader *os.File
+	for i, c := range commands {
+		outputs[i] = service.capture(opts)
+		var writer, next *os.File
+		cmd, err := command(ctx, c.Program, c.Args, opts)
+		if err == nil && i < len(commands)-1 {
+			next, writer, err = os.Pipe()
+		}
+		if err == nil {
+			if stdin := opts.stdin(); i == 0 && stdin != nil {
+				feedStdin(cmd, stdin)
+			} else if reader != nil {
+				cmd.Stdin = reader
+			}
+			if writer != nil {
+				cmd.Stdout = writer
+			} else {
+				cmd.Stdout = &execStream{_capture: outputs[i], _buffer: &outputs[i]._stdout, _forward: stdout}
+			}
+			cmd.Stderr = &execStream{_capture: outputs[i], _buffer: &outputs[i]._stderr, _forward: stderr}
+			starts[i] = time.Now()
+			if err = cmd.Start(); err == nil {
+				cmds[i] = cmd
+			}
+		}
+		errs[i] = err
+		// The stages hold their own copies of the pipe ends now; closing ours
+		// lets each stage see EOF or a broken pipe once its neighbour exits.
+		if reader != nil {
+			reader.Close()
+		}
+		if writer != nil {
+			writer.Close()
+		}
+		reader = next
+	}
+	if reader != nil {
+		reader.Close()
+	}
+
+	stages := make([]*ExecResult, len(commands))
+	for i, cmd := range cmds {
+		if cmd == nil {
+			err := &ExecError{Program: commands[i].Program, Args: commands[i].Args, ExitCode: -1, Err: errs[i]}
+			stages[i] = &ExecResult{ExitCode: -1, Error: err, HasErrors: true}
+			continue
+		}
+		stages[i] = execResult(ctx, commands[i].Program, commands[i].Args, cmd, cmd.Wait(), outputs[i], starts[i])
+	}
+	stdout.Flush()
+	stderr.Flush()
+
+	result := &ExecResult{
+		Output:    output._combined.Bytes(),
+		Stdout:    output._stdout.Bytes(),
+		Stderr:    output._stderr.Bytes(),
+		Truncated: output._truncated,
+		TimedOut:  errors.Is(ctx.Err(), context.DeadlineExceeded),
+		Stages:    stages,
+	}
+	for _, stage := range stages {
+		if stage.HasErrors {
+			result.ExitCode = stage.ExitCode
+			result.Error = stage.Error
+			result.HasErrors = true
+		}
+	}
+	if ctx.Err() != nil && !errors.Is(result.Error, ctx.Err()) {
+		last := commands[len(commands)-1]
+		result.Error = &ExecError{Program: last.Program, Args: last.Args, ExitCode: result.ExitCode, Err: ctx.Err()}
+		result.HasErrors = true
+	}
+	return result
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipeline(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunPipeline([]Command{
+		{Program: "printf", Args: []string{"b\\na\\nc\\n"}},
+		{Program: "sort"},
+		{Program: "head", Args: []string{"-n", "2"}},
+	})
+
+	assert.Nil(t, res.Error)
+	assert.False(t, res.HasErrors)
+	assert.Equal(t, "a\nb\n", string(res.Stdout))
+	assert.Len(t, res.Stages, 3)
+	for _, stage := range res.Stages {
+		assert.Equal(t, 0, stage.ExitCode)
+	}
+}
+
+func TestPipelineFail(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunPipeline([]Command{
+		{Program: "sh", Args: []string{"-c", "echo x; exit 3"}},
+		{Program: "cat"},
+	})
+
+	assert.True(t, res.HasErrors)
+	assert.NotNil(t, res.Error)
+	assert.Equal(t, 3, res.ExitCode)
+	assert.Equal(t, 3, res.Stages[0].ExitCode)
+	assert.Equal(t, 0, res.Stages[1].ExitCode)
+	assert.Equal(t, "x\n", string(res.Stdout))
+}
+
+func TestPipelineStdinAndStderr(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunPipeline([]Command{
+		{Program: "sh", Args: []string{"-c", "cat; echo first >&2"}},
+		{Program: "sh", Args: []string{"-c", "tr a-z A-Z; echo second >&2"}},
+	}, ExecOptions{Stdin: strings.NewReader("hello")})
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, "HELLO", string(res.Stdout))
+	assert.Contains(t, string(res.Stderr), "first\n")
+	assert.Contains(t, string(res.Stderr), "second\n")
+	assert.Equal(t, "first\n", string(res.Stages[0].Stderr))
+	assert.Equal(t, "second\n", string(res.Stages[1].Stderr))
+}
+
+func TestPipelineMissingProgram(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunPipeline([]Command{
+		{Program: "echo", Args: []string{"hi"}},
+		{Program: "go_utils_no_such_program"},
+		{Program: "cat"},
+	})
+
+	assert.True(t, res.HasErrors)
+	assert.Equal(t, -1, res.ExitCode)
+	assert.Equal(t, -1, res.Stages[1].ExitCode)
+	assert.NotNil(t, res.Stages[1].Error)
+	assert.Empty(t, res.Stdout)
+}
+
+func TestPipelineTimeout(t *testing.T) {
+	var service = GetExecService()
+	started := time.Now()
+	res := service.RunPipeline([]Command{
+		{Program: "sleep", Args: []string{"30"}},
+		{Program: "cat"},
+	}, ExecOptions{Timeout: 200 * time.Millisecond})
+
+	assert.Less(t, time.Since(started), 5*time.Second)
+	assert.True(t, res.TimedOut)
+	assert.True(t, errors.Is(res.Error, context.DeadlineExceeded))
+	assert.True(t, IsExecError(res.Error))
+}
+
+func TestPipelineEmpty(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunPipeline(nil)
+
+	assert.True(t, res.HasErrors)
+	assert.NotNil(t, res.Error)
+}
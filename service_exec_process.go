@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Process is a command started in the background by ExecService.Start.
+// Its output can be read while it runs.
+type Process struct {
+	Program  string
+	Args     []string
+	_cmd     *exec.Cmd
+	_cancel  context.CancelFunc
+	_output  *execCapture
+	_done    chan struct{}
+	_result  *ExecResult
+	_stopped sync.Once
+}
+
+// Start runs a command in the background. It keeps running until it exits,
+// is stopped, or its Timeout expires, and is listed by Processes meanwhile.
+func (service *DefaultExecService) Start(program string, args []string, options ...ExecOptions) (*Process, error) {
+	opts := ExecOptions{}
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), opts.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	cmd, err := command(ctx, program, args, opts)
+	if err != nil {
+		cancel()
+		return nil, &ExecError{Program: program, Args: args, ExitCode: -1, Err: err}
+	}
+
+	output := service.capture(opts)
+	stdout := &execStream{_capture: output, _buffer: &output._stdout, _forward: opts.Stdout}
+	stderr := &execStream{_capture: output, _buffer: &output._stderr, _forward: opts.Stderr}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if stdin := opts.stdin(); stdin != nil {
+		feedStdin(cmd, stdin)
+	}
+	started := time.Now()
+	if err = cmd.Start(); err != nil {
+		cancel()
+		return nil, &ExecError{Program: program, Args: args, ExitCode: -1, Err: err}
+	}
+
+	process := &Process{
+		Program: program,
+		Args:    args,
+		_cmd:    cmd,
+		_cancel: cancel,
+		_output: output,
+		_done:   make(chan struct{}),
+	}
+	service._lock.Lock()
+	service._processes = append(service._processes, process)
+	service._lock.Unlock()
+
+	go func() {
+		err := cmd.Wait()
+		stdout.Flush()
+		stderr.Flush()
+		process._result = execResult(ctx, program, args, cmd, err, output, started)
+		cancel()
+		service.untrack(process)
+		close(process._done)
+	}()
+	return process, nil
+}
+
+// Processes returns the started processes that are still running.
+func (service *DefaultExecService) Processes() []*Process {
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	return append([]*Process{}, service._processes...)
+}
+
+// StopAll stops every running process, as Stop does, and waits for them.
+func (service *DefaultExecService) StopAll(grace time.Duration) error {
+	processes := service.Processes()
+	errs := make([]error, len(processes))
+	var wg sync.WaitGroup
+	for i, process := range processes {
+		wg.Add(1)
+		go func(i int, process *Process) {
+			defer wg.Done()
+			errs[i] = process.Stop(grace)
+		}(i, process)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (service *DefaultExecService) untrack(process *Process) {
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	for i := range service._processes {
+		if service._processes[i] == process {
+			service._processes = append(service._processes[:i], service._processes[i+1:]...)
+			return
+		}
+	}
+}
+
+// finishedProcess returns a process that has already exited with result.
+func finishedProcess(program string, args []string, result *ExecResult) *Process {
+	process := &Process{
+		Program: program,
+		Args:    args,
+		_output: &execCapture{},
+		_done:   make(chan struct{}),
+		_result: result,
+	}
+	process._output._stdout.Write(result.Stdout)
+	process._output._stderr.Write(result.Stderr)
+	process._output._combined.Write(result.Output)
+	close(process._done)
+	return process
+}
+
+func (process *Process) Pid() int {
+	if process._cmd == nil {
+		return 0
+	}
+	return process._cmd.Process.Pid
+}
+
+func (process *Process) Signal(sig os.Signal) error {
+	if process._cmd == nil {
+		return os.ErrProcessDone
+	}
+	return process._cmd.Process.Signal(sig)
+}
+
+// Stop asks the process and its children to terminate, and kills them once
+// grace has passed. It returns when the process has exited.
+func (process *Process) Stop(grace time.Duration) error {
+	select {
+	case <-process._done:
+		return nil
+	default:
+	}
+	var err error
+	process._stopped.Do(func() {
+		if err = terminateProcessGroup(process._cmd); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			err = fmt.Errorf("failed to stop program '%s': %v", process.Program, err)
+		} else {
+			err = nil
+		}
+	})
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-process._done:
+	case <-timer.C:
+		process._cancel()
+		<-process._done
+	}
+	return err
+}
+
+// Wait blocks until the process exits and returns its result.
+func (process *Process) Wait() *ExecResult {
+	<-process._done
+	return process._result
+}
+
+func (process *Process) Done() <-chan struct{} {
+	return process._done
+}
+
+// Result returns the result of an exited process, or nil while it runs.
+func (process *Process) Result() *ExecResult {
+	select {
+	case <-process._done:
+		return process._result
+	default:
+		return nil
+	}
+}
+
+// Output returns the interleaved output written so far.
+func (process *Process) Output() []byte {
+	return process._output.snapshot(&process._output._combined)
+}
+
+func (process *Process) Stdout() []byte {
+	return process._output.snapshot(&process._output._stdout)
+}
+
+func (process *Process) Stderr() []byte {
+	return process._output.snapshot(&process._output._stderr)
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessStop(t *testing.T) {
+	var service = GetExecService()
+	process, err := service.Start("sh", []string{"-c", "echo ready; sleep 30 & wait"})
+	assert.Nil(t, err)
+	assert.NotZero(t, process.Pid())
+	assert.Eventually(t, func() bool { return string(process.Stdout()) == "ready\n" }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []*Process{process}, service.Processes())
+	assert.Nil(t, process.Result())
+
+	started := time.Now()
+	assert.Nil(t, process.Stop(5*time.Second))
+	assert.Less(t, time.Since(started), 3*time.Second)
+	res := process.Wait()
+	assert.True(t, res.HasErrors)
+	assert.Equal(t, "ready\n", string(res.Stdout))
+	assert.Empty(t, service.Processes())
+	assert.Nil(t, process.Stop(time.Second))
+}
+
+func TestProcessStopGraceful(t *testing.T) {
+	var service = GetExecService()
+	process, err := service.Start("sh", []string{"-c", `trap 'echo bye; exit 0' TERM; echo ready; while true; do sleep 0.05; done`})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool { return strings.Contains(string(process.Output()), "ready") }, 5*time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, process.Stop(5*time.Second))
+	res := process.Result()
+	assert.Nil(t, res.Error)
+	assert.Equal(t, 0, res.ExitCode)
+	assert.Equal(t, "ready\nbye\n", string(res.Stdout))
+}
+
+func TestProcessStopKillsAfterGrace(t *testing.T) {
+	var service = GetExecService()
+	process, err := service.Start("sh", []string{"-c", `trap '' TERM; echo ready; while true; do sleep 0.05; done`})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool { return len(process.Stdout()) > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, process.Stop(100*time.Millisecond))
+	assert.True(t, process.Result().HasErrors)
+}
+
+func TestProcessSignalAndExit(t *testing.T) {
+	var service = GetExecService()
+	process, err := service.Start("sh", []string{"-c", `trap 'exit 7' INT; echo ready; while true; do sleep 0.05; done`})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool { return len(process.Stdout()) > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, process.Signal(os.Interrupt))
+	<-process.Done()
+	assert.Equal(t, 7, process.Result().ExitCode)
+}
+
+func TestProcessStopAll(t *testing.T) {
+	var service = GetExecService()
+	for i := 0; i < 3; i++ {
+		_, err := service.Start("sleep", []string{"30"})
+		assert.Nil(t, err)
+	}
+	assert.Len(t, service.Processes(), 3)
+
+	assert.Nil(t, service.StopAll(time.Second))
+	assert.Empty(t, service.Processes())
+}
+
+func TestProcessStartMissingProgram(t *testing.T) {
+	var service = GetExecService()
+	process, err := service.Start("go_utils_no_such_program", []string{})
+
+	assert.Nil(t, process)
+	assert.NotNil(t, err)
+}
+
+func TestProcessTimeout(t *testing.T) {
+	var service = GetExecService()
+	process, err := service.Start("sleep", []string{"30"}, ExecOptions{Timeout: 100 * time.Millisecond})
+	assert.Nil(t, err)
+
+	res := process.Wait()
+	assert.True(t, res.TimedOut)
+	assert.Empty(t, service.Processes())
+}
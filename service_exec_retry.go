@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"time"
+)
+
+const execRetryDelay = time.Second
+
+// ExecRetryPolicy runs a failed command or pipeline again, waiting
+// InitialDelay (1s by default) before the first retry and Multiplier (2 by
+// default) times longer before each following one, up to MaxDelay. Only
+// failures with one of ExitCodes, or with output matching OutputPattern, are
+// retried; with neither set, every failure is. MaxAttempts counts the first
+// run and defaults to 3. The options' Timeout applies to each attempt on its
+// own. Start ignores the policy.
+type ExecRetryPolicy struct {
+	MaxAttempts   int
+	ExitCodes     []int
+	OutputPattern *regexp.Regexp
+	InitialDelay  time.Duration
+	MaxDelay      time.Duration
+	Multiplier    float64
+}
+
+func (policy *ExecRetryPolicy) retries(result *ExecResult) bool {
+	if !result.HasErrors {
+		return false
+	} else if len(policy.ExitCodes) == 0 && policy.OutputPattern == nil {
+		return true
+	}
+	for _, code := range policy.ExitCodes {
+		if result.ExitCode == code {
+			return true
+		}
+	}
+	return policy.OutputPattern != nil && policy.OutputPattern.Match(result.Output)
+}
+
+// retryExec runs a command as often as the retry policy in opts allows and
+// returns the last result, with every attempt's result in Attempts. The last
+// entry is a copy, so that the result does not contain itself. Stdin is read
+// up front so that each attempt gets all of it.
+func retryExec(ctx context.Context, opts ExecOptions, run func(opts ExecOptions) *ExecResult) *ExecResult {
+	policy := opts.Retry
+	if policy == nil {
+		return run(opts)
+	}
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 3
+	}
+	delay := policy.InitialDelay
+	if delay <= 0 {
+		delay = execRetryDelay
+	}
+	multiplier := policy.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	var stdin []byte
+	if opts.Stdin != nil {
+		var err error
+		if stdin, err = io.ReadAll(opts.Stdin); err != nil {
+			return &ExecResult{ExitCode: -1, Error: err, HasErrors: true}
+		}
+	}
+
+	attempts := []*ExecResult{}
+	for {
+		if stdin != nil {
+			opts.Stdin = bytes.NewReader(stdin)
+		}
+		result := run(opts)
+		done := len(attempts)+1 >= maxAttempts || ctx.Err() != nil || !policy.retries(result)
+		if done || sleepContext(ctx, GetSystemClock(), delay) != nil {
+			last := *result
+			result.Attempts = append(attempts, &last)
+			return result
+		}
+		attempts = append(attempts, result)
+		delay = time.Duration(float64(delay) * multiplier)
+		if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecRetry(t *testing.T) {
+	var service = GetExecService()
+	counter := filepath.Join(t.TempDir(), "count")
+	script := `n=$(cat "$0" 2>/dev/null || echo 0); n=$((n+1)); echo $n > "$0"; echo attempt $n; [ $n -ge 3 ] || exit 75`
+
+	started := time.Now()
+	res := service.RunCmd("sh", []string{"-c", script, counter}, ExecOptions{Retry: &ExecRetryPolicy{
+		MaxAttempts:  5,
+		ExitCodes:    []int{75},
+		InitialDelay: 20 * time.Millisecond,
+	}})
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, "attempt 3\n", string(res.Stdout))
+	assert.Len(t, res.Attempts, 3)
+	assert.Equal(t, 75, res.Attempts[0].ExitCode)
+	assert.Equal(t, 75, res.Attempts[1].ExitCode)
+	assert.Equal(t, 0, res.Attempts[2].ExitCode)
+	assert.Empty(t, res.Attempts[2].Attempts)
+	_, err := json.Marshal(res)
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, time.Since(started), 60*time.Millisecond)
+}
+
+func TestExecRetryGivesUp(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunCmd("sh", []string{"-c", "exit 2"}, ExecOptions{Retry: &ExecRetryPolicy{
+		MaxAttempts:  2,
+		InitialDelay: time.Millisecond,
+	}})
+
+	assert.True(t, res.HasErrors)
+	assert.Equal(t, 2, res.ExitCode)
+	assert.Len(t, res.Attempts, 2)
+}
+
+func TestExecRetryOnlyMatchingFailures(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunCmd("sh", []string{"-c", "echo fatal >&2; exit 1"}, ExecOptions{Retry: &ExecRetryPolicy{
+		ExitCodes:     []int{75},
+		InitialDelay:  time.Millisecond,
+		OutputPattern: regexp.MustCompile(`(?i)timed out`),
+	}})
+	assert.Len(t, res.Attempts, 1)
+
+	res = service.RunCmd("sh", []string{"-c", "echo 'connection timed out' >&2; exit 1"}, ExecOptions{Retry: &ExecRetryPolicy{
+		InitialDelay:  time.Millisecond,
+		OutputPattern: regexp.MustCompile(`(?i)timed out`),
+	}})
+	assert.Len(t, res.Attempts, 3)
+}
+
+func TestExecRetryStdin(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunCmd("sh", []string{"-c", "cat; exit 1"}, ExecOptions{
+		Stdin: strings.NewReader("data"),
+		Retry: &ExecRetryPolicy{MaxAttempts: 2, InitialDelay: time.Millisecond},
+	})
+
+	assert.Equal(t, "data", string(res.Attempts[0].Stdout))
+	assert.Equal(t, "data", string(res.Attempts[1].Stdout))
+
+	res = service.RunCmd("sh", []string{"-c", "cat; exit 1"}, ExecOptions{
+		StdinString: "text",
+		Retry:       &ExecRetryPolicy{MaxAttempts: 2, InitialDelay: time.Millisecond},
+	})
+	assert.Equal(t, "text", string(res.Attempts[1].Stdout))
+}
+
+func TestExecRetryCancelled(t *testing.T) {
+	var service = GetExecService()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	res := service.RunCmdContext(ctx, "false", []string{}, ExecOptions{Retry: &ExecRetryPolicy{
+		MaxAttempts:  10,
+		InitialDelay: 10 * time.Second,
+	}})
+
+	assert.Less(t, time.Since(started), 5*time.Second)
+	assert.True(t, res.HasErrors)
+	assert.Len(t, res.Attempts, 1)
+}
+
+func TestFakeExecRetry(t *testing.T) {
+	fake := NewFakeExecService(t)
+	fake.Expect("git", "fetch").ReturnOutput("", 128).Once()
+	fake.Expect("git", "fetch").ReturnOutput("done", 0)
+
+	res := fake.RunCmd("git", []string{"fetch"}, ExecOptions{Retry: &ExecRetryPolicy{
+		ExitCodes:    []int{128},
+		InitialDelay: time.Millisecond,
+	}})
+
+	assert.Nil(t, res.Error)
+	assert.Len(t, res.Attempts, 2)
+	assert.Nil(t, fake.Verify())
+}
+
+func TestExecRetryDefaultDelay(t *testing.T) {
+	var service = GetExecService()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	res := service.RunCmdContext(ctx, "false", []string{}, ExecOptions{Retry: &ExecRetryPolicy{}})
+
+	assert.Len(t, res.Attempts, 1)
+}
+
+func TestExecRetryPipeline(t *testing.T) {
+	var service = GetExecService()
+	counter := filepath.Join(t.TempDir(), "count")
+	script := `n=$(cat "$0" 2>/dev/null || echo 0); n=$((n+1)); echo $n > "$0"; echo attempt $n; [ $n -ge 2 ] || exit 75`
+
+	res := service.RunPipeline([]Command{
+		{Program: "sh", Args: []string{"-c", script, counter}},
+		{Program: "cat"},
+	}, ExecOptions{Retry: &ExecRetryPolicy{ExitCodes: []int{75}, InitialDelay: time.Millisecond}})
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, "attempt 2\n", string(res.Stdout))
+	assert.Len(t, res.Attempts, 2)
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// ExecLineWriter splits what is written to it into lines and passes each
+// one, without its line ending, to a callback. Give it as the Stdout or
+// Stderr of RunCmd options to follow a command's output while it runs.
+type ExecLineWriter struct {
+	_lock    sync.Mutex
+	_onLine  func(line string)
+	_pending []byte
+}
+
+func NewExecLineWriter(onLine func(line string)) *ExecLineWriter {
+	return &ExecLineWriter{_onLine: onLine}
+}
+
+// NewExecPrefixWriter copies every line to w with prefix in front of it.
+func NewExecPrefixWriter(w io.Writer, prefix string) *ExecLineWriter {
+	var lock sync.Mutex
+	return NewExecLineWriter(func(line string) {
+		lock.Lock()
+		defer lock.Unlock()
+		io.WriteString(w, prefix+line+"\n")
+	})
+}
+
+func (writer *ExecLineWriter) Write(p []byte) (int, error) {
+	writer._lock.Lock()
+	defer writer._lock.Unlock()
+	writer._pending = append(writer._pending, p...)
+	for {
+		end := bytes.IndexByte(writer._pending, '\n')
+		if end < 0 {
+			break
+		}
+		line := writer._pending[:end]
+		writer._pending = writer._pending[end+1:]
+		writer._onLine(string(bytes.TrimSuffix(line, []byte("\r"))))
+	}
+	return len(p), nil
+}
+
+// Flush passes on a last line that was not terminated by a newline.
+// RunCmd calls it once the command exits.
+func (writer *ExecLineWriter) Flush() error {
+	writer._lock.Lock()
+	defer writer._lock.Unlock()
+	if len(writer._pending) > 0 {
+		writer._onLine(string(writer._pending))
+		writer._pending = nil
+	}
+	return nil
+}
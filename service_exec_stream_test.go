@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecLineWriter(t *testing.T) {
+	lines := []string{}
+	writer := NewExecLineWriter(func(line string) { lines = append(lines, line) })
+	writer.Write([]byte("first\r\nsec"))
+	writer.Write([]byte("ond\nthird"))
+	assert.Equal(t, []string{"first", "second"}, lines)
+
+	writer.Flush()
+	assert.Equal(t, []string{"first", "second", "third"}, lines)
+}
+
+func TestExecStreamsLines(t *testing.T) {
+	var service = GetExecService()
+	stdout := []string{}
+	var stderr bytes.Buffer
+	res := service.RunCmd("sh", []string{"-c", "echo one; echo oops >&2; printf two"}, ExecOptions{
+		Stdout: NewExecLineWriter(func(line string) { stdout = append(stdout, line) }),
+		Stderr: NewExecPrefixWriter(&stderr, "[deploy] "),
+	})
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, []string{"one", "two"}, stdout)
+	assert.Equal(t, "[deploy] oops\n", stderr.String())
+	assert.Equal(t, "one\ntwo", string(res.Stdout))
+}
+
+func TestExecStreamsToSharedWriter(t *testing.T) {
+	var service = GetExecService()
+	var output bytes.Buffer
+	script := "for i in 1 2 3 4 5 6 7 8 9 10; do echo out$i; echo err$i >&2; done"
+	res := service.RunCmd("sh", []string{"-c", script}, ExecOptions{Stdout: &output, Stderr: &output})
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, len(res.Output), output.Len())
+}
@@ -1,9 +1,16 @@
 package utils
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -15,7 +22,7 @@ func TestExec(t *testing.T) {
 
 func TestExecWithPwd(t *testing.T) {
 	var service = GetExecService()
-	res := service.RunCmd("pwd", []string{}, &exec.Cmd{Dir: "/"})
+	res := service.RunCmd("pwd", []string{}, ExecOptions{Dir: "/"})
 
 	assert.NotNil(t, res)
 	assert.Nil(t, res.Error)
@@ -31,3 +38,151 @@ func TestExecWithError(t *testing.T) {
 	assert.True(t, res.HasErrors)
 	assert.NotZero(t, res.ExitCode)
 }
+
+func TestExecMissingProgram(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunCmd("go_utils_no_such_program", []string{})
+
+	assert.NotNil(t, res.Error)
+	assert.True(t, res.HasErrors)
+	assert.Equal(t, -1, res.ExitCode)
+}
+
+func TestExecContextTimeout(t *testing.T) {
+	var service = GetExecService()
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	res := service.RunCmdContext(ctx, "sh", []string{"-c", "echo partial; sleep 30 & wait"})
+
+	assert.Less(t, time.Since(started), 5*time.Second)
+	assert.True(t, res.TimedOut)
+	assert.True(t, res.HasErrors)
+	assert.True(t, errors.Is(res.Error, context.DeadlineExceeded))
+	assert.Equal(t, "partial", strings.TrimSpace(string(res.Output)))
+}
+
+func TestExecContextCancelled(t *testing.T) {
+	var service = GetExecService()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res := service.RunCmdContext(ctx, "sleep", []string{"5"})
+
+	assert.False(t, res.TimedOut)
+	assert.True(t, errors.Is(res.Error, context.Canceled))
+}
+
+func TestExecSeparatesStdoutAndStderr(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunCmd("sh", []string{"-c", `echo '{"ok":true}'; echo warning >&2`})
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, "{\"ok\":true}\n", string(res.Stdout))
+	assert.Equal(t, "warning\n", string(res.Stderr))
+	assert.Contains(t, string(res.Output), "warning")
+	assert.Contains(t, string(res.Output), "ok")
+	assert.False(t, res.Truncated)
+}
+
+func TestExecOutputLimit(t *testing.T) {
+	var service = GetExecService(ExecServiceOptions{OutputLimit: 4})
+	res := service.RunCmd("sh", []string{"-c", "echo 123456789; echo abcdefgh >&2"})
+
+	assert.Nil(t, res.Error)
+	assert.True(t, res.Truncated)
+	assert.Equal(t, "1234", string(res.Stdout))
+	assert.Equal(t, "abcd", string(res.Stderr))
+	assert.Len(t, res.Output, 4)
+}
+
+func TestExecStdin(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunCmd("cat", []string{}, ExecOptions{Stdin: strings.NewReader("select 1;\n")})
+	assert.Nil(t, res.Error)
+	assert.Equal(t, "select 1;\n", string(res.Stdout))
+
+	res = service.RunCmd("wc", []string{"-c"}, ExecOptions{Stdin: bytes.NewReader([]byte{1, 2, 3})})
+	assert.Nil(t, res.Error)
+	assert.Equal(t, "3", strings.TrimSpace(string(res.Stdout)))
+	res = service.RunCmd("wc", []string{"-c"}, ExecOptions{StdinBytes: []byte{1, 2, 3, 4}})
+	assert.Equal(t, "4", strings.TrimSpace(string(res.Stdout)))
+
+	res = service.RunCmd("cat", []string{}, ExecOptions{StdinString: "select 2;"})
+	assert.Equal(t, "select 2;", string(res.Stdout))
+}
+
+func TestExecStdinClosedOnCancel(t *testing.T) {
+	var service = GetExecService()
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	res := service.RunCmdContext(ctx, "cat", []string{}, ExecOptions{Stdin: reader})
+
+	assert.True(t, res.TimedOut)
+}
+
+func TestExecEnv(t *testing.T) {
+	var service = GetExecService()
+	t.Setenv("GO_UTILS_PARENT", "parent")
+	res := service.RunCmd("sh", []string{"-c", "echo $GO_UTILS_PARENT $GO_UTILS_A $GO_UTILS_B"}, ExecOptions{
+		Env:      []string{"GO_UTILS_A=a"},
+		ExtraEnv: map[string]string{"GO_UTILS_B": "b"},
+	})
+	assert.Nil(t, res.Error)
+	assert.Equal(t, "parent a b", strings.TrimSpace(string(res.Stdout)))
+
+	res = service.RunCmd("/bin/sh", []string{"-c", "echo \"[$GO_UTILS_PARENT]\""}, ExecOptions{ReplaceEnv: true})
+	assert.Nil(t, res.Error)
+	assert.Equal(t, "[]", strings.TrimSpace(string(res.Stdout)))
+}
+
+func TestExecOptionsTimeout(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunCmd("sleep", []string{"5"}, ExecOptions{Timeout: 100 * time.Millisecond})
+
+	assert.True(t, res.TimedOut)
+	assert.True(t, errors.Is(res.Error, context.DeadlineExceeded))
+}
+
+func TestExecOptionsOutputLimit(t *testing.T) {
+	var service = GetExecService(ExecServiceOptions{OutputLimit: 6})
+	res := service.RunCmd("echo", []string{"123456789"}, ExecOptions{OutputLimit: 3})
+
+	assert.True(t, res.Truncated)
+	assert.Equal(t, "123", string(res.Stdout))
+}
+
+func TestExecUmask(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunCmd("sh", []string{"-c", "umask"}, ExecOptions{Umask: 0o027})
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, "0027", strings.TrimSpace(string(res.Stdout)))
+
+	res = service.RunCmd("go_utils_no_such_program", []string{}, ExecOptions{Umask: 0o027})
+	assert.True(t, errors.Is(res.Error, exec.ErrNotFound))
+	assert.Equal(t, -1, res.ExitCode)
+}
+
+func TestExecUmaskWithDir(t *testing.T) {
+	var service = GetExecService()
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "s.sh"), []byte("#!/bin/sh\numask\n"), 0o755))
+	res := service.RunCmd("./s.sh", nil, ExecOptions{Dir: dir, Umask: 0o022})
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, "0022", strings.TrimSpace(string(res.Stdout)))
+
+	res = service.RunCmd("./missing.sh", nil, ExecOptions{Dir: dir, Umask: 0o022})
+	assert.True(t, res.HasErrors)
+	assert.Equal(t, -1, res.ExitCode)
+}
+
+func TestExecUnknownUser(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunCmd("pwd", []string{}, ExecOptions{User: "go_utils_no_such_user"})
+
+	assert.True(t, res.HasErrors)
+	assert.Contains(t, res.Error.Error(), "go_utils_no_such_user")
+}
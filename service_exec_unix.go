@@ -0,0 +1,94 @@
+//go:build unix
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// killProcessGroupOnCancel starts the command in its own process group and
+// kills the whole group, not just the leader, when its context is done.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// runAsUser runs the command with the uid and primary gid of the given user
+// name or numeric uid.
+func runAsUser(cmd *exec.Cmd, name string) error {
+	account, err := user.Lookup(name)
+	if err != nil {
+		if account, err = user.LookupId(name); err != nil {
+			return fmt.Errorf("unknown user '%s': %v", name, err)
+		}
+	}
+	uid, err := strconv.ParseUint(account.Uid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid uid '%s' for user '%s'", account.Uid, name)
+	}
+	gid, err := strconv.ParseUint(account.Gid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid gid '%s' for user '%s'", account.Gid, name)
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	return nil
+}
+
+// withUmask runs the program through sh so the umask only applies to the
+// child, as the process-wide umask cannot be changed safely. The program is
+// looked up first so that a missing one fails as it would without sh. A
+// relative path is resolved in dir, where sh runs.
+func withUmask(program string, args []string, umask os.FileMode, dir string) (string, []string, error) {
+	path := program
+	if !strings.Contains(program, "/") {
+		var err error
+		if path, err = exec.LookPath(program); err != nil {
+			return "", nil, err
+		}
+	} else {
+		resolved := program
+		if dir != "" && !filepath.IsAbs(program) {
+			resolved = dir + "/" + program
+		}
+		if _, err := exec.LookPath(resolved); err != nil {
+			return "", nil, err
+		}
+	}
+	script := fmt.Sprintf(`umask %03o && exec "$0" "$@"`, umask.Perm())
+	return "sh", append([]string{"-c", script, path}, args...), nil
+}
+
+// terminateProcessGroup sends SIGTERM to the command and its children.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	if err == syscall.ESRCH {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+// execSignal returns the signal that killed the process, if any.
+func execSignal(state *os.ProcessState) os.Signal {
+	if state == nil {
+		return nil
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return status.Signal()
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package utils
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecKeepsProcessGroupWithoutContext(t *testing.T) {
+	var service = GetExecService()
+	res := service.RunCmd("sh", []string{"-c", "ps -o pgid= -p $$"})
+	assert.Nil(t, res.Error)
+	assert.Equal(t, strconv.Itoa(syscall.Getpgrp()), strings.TrimSpace(string(res.Stdout)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	res = service.RunCmdContext(ctx, "sh", []string{"-c", "ps -o pgid= -p $$"})
+	assert.Nil(t, res.Error)
+	assert.NotEqual(t, strconv.Itoa(syscall.Getpgrp()), strings.TrimSpace(string(res.Stdout)))
+}
@@ -1,88 +1,485 @@
 package utils
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type JobCompleteCallback = func(jobId string, result any, err error)
 type JobAction = func() (result any, err error)
+type JobContextAction = func(ctx *JobContext) (result any, err error)
+type JobHandler = func(payload []byte) (result any, err error)
 
 type Job struct {
-	Id       string
-	Action   JobAction
-	Callback JobCompleteCallback
+	Id            string
+	Action        JobAction
+	ContextAction JobContextAction
+	Callback      JobCompleteCallback
+	Type          string
+	Payload       []byte
+	DependsOn     []string
+	Key           string
+	Priority      int
+	Group         string
+	_createdAt    time.Time
 }
 
+// Jobs report JOB_STATUS_FAILED when they return an error or panic, and keep
+// reporting it for jobFailedRetention after finishing. Ids the service does
+// not know, including those of jobs that finished longer ago, report
+// JOB_STATUS_COMPLETE.
 const (
 	JOB_STATUS_WORKING = iota
 	JOB_STATUS_COMPLETE
+	JOB_STATUS_FAILED
+	JOB_STATUS_QUEUED
+	JOB_STATUS_SCHEDULED
 )
 
+const jobProgressBuffer = 16
+
+const jobFailedRetention = time.Hour
+
+var ErrJobServiceClosed = errors.New("job service is shut down")
+
+type JobServiceOptions struct {
+	Store   JobStore
+	OnPanic JobPanicHook
+	Clock   Clock
+	// DedupPolicy decides what Start does with a job whose Key is taken by a
+	// running job, or one finished within DedupWindow. With JOB_DEDUP_ATTACH
+	// the job does not run; its Id is set to the existing job's id and its
+	// Callback gets that job's result.
+	DedupPolicy int
+	DedupWindow time.Duration
+	// MaxWorkers caps concurrently running jobs; 0 means unlimited. Queued
+	// jobs run by Priority, gaining one level per AgingInterval of waiting.
+	MaxWorkers    int
+	AgingInterval time.Duration
+	// Broker receives handler jobs passed to Start instead of running them
+	// locally; processes calling Consume pick them up.
+	Broker JobBroker
+}
+
 type JobService interface {
 	Start(job *Job) error
 	Status(id string) int
 	Stop(id string)
 	Wait(id string)
+	RegisterHandler(jobType string, handler JobHandler)
+	Resume(callback JobCompleteCallback) ([]string, error)
+	Progress(id string) (JobProgress, bool)
+	Subscribe(id string) (<-chan JobProgress, func())
+	StartGraph(jobs []*Job, options ...JobGraphOptions) (string, error)
+	StartBatch(jobs []*Job, onDone JobGraphCallback, options ...JobBatchOptions) (string, error)
+	Shutdown(ctx context.Context) ([]string, error)
+	Use(middleware ...JobMiddleware)
+	AddHook(hook JobHook)
+	SetRateLimit(group string, limit RateLimit)
+	QueueLength() int
+	Consume(ctx context.Context, options ...JobConsumerOptions) error
+	StartAt(job *Job, at time.Time) error
+	StartAfter(job *Job, delay time.Duration) error
+	List() []JobInfo
 }
 
-func GetJobService() JobService {
-	return &DefaultJobService{
-		_jobs:       make(map[string]*Job),
-		_waitGroups: make(map[string]*sync.WaitGroup),
+func GetJobService(options ...JobServiceOptions) JobService {
+	service := &DefaultJobService{
+		_jobs:     make(map[string]*jobEntry),
+		_handlers: make(map[string]JobHandler),
+		_failed:   make(map[string]time.Time),
+		_closing:  make(chan struct{}),
+		_keys:     make(map[string]*jobKey),
+		_limits:   make(map[string]*tokenBucket),
+		_clock:    GetSystemClock(),
 	}
+	if len(options) > 0 {
+		service._store = options[0].Store
+		service._onPanic = options[0].OnPanic
+		service._dedupPolicy = options[0].DedupPolicy
+		service._dedupWindow = options[0].DedupWindow
+		service._maxWorkers = options[0].MaxWorkers
+		service._agingInterval = options[0].AgingInterval
+		service._broker = options[0].Broker
+		if options[0].Clock != nil {
+			service._clock = options[0].Clock
+		}
+	}
+	return service
 }
 
 func NewJob(action JobAction, callback JobCompleteCallback) *Job {
 	return &Job{
-		Id:       uuid.NewString(), /*TODO: generate new uuid*/
+		Id:       uuid.NewString(),
 		Action:   action,
 		Callback: callback,
 	}
 }
 
+// NewContextJob creates a job whose action can observe cancellation and
+// report progress through its JobContext.
+func NewContextJob(action JobContextAction, callback JobCompleteCallback) *Job {
+	return &Job{
+		Id:            uuid.NewString(),
+		ContextAction: action,
+		Callback:      callback,
+	}
+}
+
+// NewHandlerJob creates a job run by the handler registered for jobType.
+// Such jobs are persisted in the service's JobStore until they complete.
+func NewHandlerJob(jobType string, payload any, callback JobCompleteCallback) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Job{
+		Id:       uuid.NewString(),
+		Callback: callback,
+		Type:     jobType,
+		Payload:  data,
+	}, nil
+}
+
 type DefaultJobService struct {
-	_jobs       map[string]*Job
-	_waitGroups map[string]*sync.WaitGroup
+	_lock     sync.Mutex
+	_jobs     map[string]*jobEntry
+	_handlers map[string]JobHandler
+	_store    JobStore
+	_onPanic  JobPanicHook
+	_failed   map[string]time.Time
+	_closed   bool
+	_closing  chan struct{}
+	_active   sync.WaitGroup
+	_clock    Clock
+	_keys     map[string]*jobKey
+
+	_dedupPolicy int
+	_dedupWindow time.Duration
+
+	_maxWorkers    int
+	_agingInterval time.Duration
+	_working       int
+	_queue         []*jobEntry
+
+	_middleware []JobMiddleware
+	_hooks      []JobHook
+	_limits     map[string]*tokenBucket
+	_broker     JobBroker
+}
+
+type jobEntry struct {
+	_job         *Job
+	_wg          sync.WaitGroup
+	_cancel      context.CancelFunc
+	_progress    *JobProgress
+	_subscribers []chan JobProgress
+	_run         func()
+	_counted     bool
+	_queued      bool
+	_queuedAt    time.Time
+	_scheduled   bool
+	_runAt       time.Time
+	_throttled   bool
+	_buckets     []*tokenBucket
+	_timer       ClockTimer
 }
 
 func (service *DefaultJobService) Wait(id string) {
-	service._waitGroups[id].Wait()
+	service._lock.Lock()
+	entry, ok := service._jobs[id]
+	service._lock.Unlock()
+	if ok {
+		entry._wg.Wait()
+	}
+}
+
+func (service *DefaultJobService) RegisterHandler(jobType string, handler JobHandler) {
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	service._handlers[jobType] = handler
 }
 
 func (service *DefaultJobService) Start(job *Job) error {
+	if service.brokered(job) {
+		return service.sendToBroker(job)
+	}
+	return service.start(job, nil, false)
+}
+
+// start runs a job. Internal starts belong to work already in flight, such as
+// graph steps, and are still accepted while the service is draining.
+func (service *DefaultJobService) start(job *Job, upstream map[string]any, internal bool) error {
+	entry, err := service.prepare(job, upstream, internal, time.Time{})
+	if err != nil {
+		return err
+	} else if entry == nil {
+		return nil
+	}
+	service.emit(JobEvent{Type: JOB_EVENT_ENQUEUED, Job: job})
+	service.admit(entry)
+	return nil
+}
+
+// prepare registers and persists a job and builds its run function. A nil
+// entry without error means the job was attached to an existing one.
+func (service *DefaultJobService) prepare(job *Job, upstream map[string]any, internal bool, runAt time.Time) (*jobEntry, error) {
 	if job == nil {
-		return fmt.Errorf("job is nil")
-	} else if job.Action == nil {
-		return fmt.Errorf("job action is nil")
-	}
-	service._jobs[job.Id] = job
-	var wg sync.WaitGroup
-	wg.Add(1)
-	service._waitGroups[job.Id] =  &wg
-	
-	go func() {
-		defer wg.Done()
-		result, err := job.Action()
-		if job.Callback != nil {
-			job.Callback(job.Id, result, err)
+		return nil, fmt.Errorf("job is nil")
+	}
+	action, err := service.resolveAction(job)
+	if err != nil {
+		return nil, err
+	}
+	if job.Key != "" {
+		if attached, err := service.claimKey(job); err != nil || attached {
+			return nil, err
 		}
-		service.Stop(job.Id)
-	}()
-	return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	entry := &jobEntry{_job: job, _cancel: cancel, _scheduled: !runAt.IsZero(), _runAt: runAt}
+	if err = service.register(entry, internal); err != nil {
+		cancel()
+		service.abandonKey(job, err)
+		return nil, err
+	}
+	persisted := service._store != nil && job.Type != ""
+	if persisted {
+		createdAt := job._createdAt
+		if createdAt.IsZero() {
+			createdAt = service._clock.Now()
+		}
+		err := service._store.Save(&JobRecord{
+			Id:        job.Id,
+			Type:      job.Type,
+			Payload:   job.Payload,
+			CreatedAt: createdAt,
+			RunAt:     runAt,
+		})
+		if err != nil {
+			cancel()
+			service.abandonKey(job, err)
+			service.finish(entry, nil)
+			service.release(entry)
+			return nil, err
+		}
+	}
+
+	jobCtx := &JobContext{
+		Context:  ctx,
+		JobId:    job.Id,
+		Upstream: upstream,
+		_report: func(progress JobProgress) {
+			service.publish(entry, progress)
+		},
+		_clock: service._clock,
+	}
+	entry._run = func() {
+		defer service.release(entry)
+		defer service.dispatch(entry)
+		defer cancel()
+		var result any
+		err := jobCtx.Err()
+		startedAt := service._clock.Now()
+		attempts := 0
+		if err == nil {
+			service.emit(JobEvent{Type: JOB_EVENT_STARTED, Job: job})
+			result, err = service.run(job, service.wrap(job, action), jobCtx)
+			attempts = 1
+		}
+		service.emit(JobEvent{
+			Type:     doneEventType(ctx, err),
+			Job:      job,
+			Result:   result,
+			Err:      err,
+			Attempts: attempts,
+			Duration: service._clock.Now().Sub(startedAt),
+		})
+		service.notify(job, result, err)
+		service.releaseKey(job, result, err)
+		if persisted {
+			service._store.Delete(job.Id)
+		}
+		service.finish(entry, err)
+	}
+	return entry, nil
+}
+
+func (service *DefaultJobService) resolveAction(job *Job) (JobContextAction, error) {
+	if job.ContextAction != nil {
+		return job.ContextAction, nil
+	} else if job.Action != nil {
+		action := job.Action
+		return func(ctx *JobContext) (result any, err error) {
+			return action()
+		}, nil
+	} else if job.Type != "" {
+		service._lock.Lock()
+		handler, ok := service._handlers[job.Type]
+		service._lock.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("no handler registered for job type '%s'", job.Type)
+		}
+		payload := job.Payload
+		return func(ctx *JobContext) (result any, err error) {
+			return handler(payload)
+		}, nil
+	}
+	return nil, fmt.Errorf("job action is nil")
+}
+
+// Resume restarts jobs left in the store by a previous run of the process.
+func (service *DefaultJobService) Resume(callback JobCompleteCallback) ([]string, error) {
+	if service._store == nil {
+		return nil, fmt.Errorf("job service has no store")
+	}
+	records, err := service._store.List()
+	if err != nil {
+		return nil, err
+	}
+	resumed := []string{}
+	for _, record := range records {
+		service._lock.Lock()
+		_, running := service._jobs[record.Id]
+		service._lock.Unlock()
+		if running {
+			continue
+		}
+		job := &Job{
+			Id:         record.Id,
+			Callback:   callback,
+			Type:       record.Type,
+			Payload:    record.Payload,
+			_createdAt: record.CreatedAt,
+		}
+		if record.RunAt.After(service._clock.Now()) {
+			err = service.StartAt(job, record.RunAt)
+		} else {
+			err = service.start(job, nil, false)
+		}
+		if err != nil {
+			return resumed, err
+		}
+		resumed = append(resumed, record.Id)
+	}
+	return resumed, nil
 }
 
 func (service *DefaultJobService) Status(id string) int {
-	_, ok := service._jobs[id]
-	if !ok {
-		return JOB_STATUS_COMPLETE
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	if entry, ok := service._jobs[id]; ok {
+		return entry.status()
+	} else if failedAt, ok := service._failed[id]; ok && service._clock.Now().Sub(failedAt) < jobFailedRetention {
+		return JOB_STATUS_FAILED
 	}
-	return JOB_STATUS_WORKING
+	return JOB_STATUS_COMPLETE
 }
 
 func (service *DefaultJobService) Stop(id string) {
-	delete(service._jobs, id)
-	delete(service._waitGroups, id)
+	service._lock.Lock()
+	entry, ok := service._jobs[id]
+	service._lock.Unlock()
+	if ok {
+		entry._cancel()
+		service.unqueue(entry)
+		service.finish(entry, nil)
+	}
+}
+
+func (service *DefaultJobService) register(entry *jobEntry, internal bool) error {
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	if service._closed && !internal {
+		return ErrJobServiceClosed
+	}
+	entry._wg.Add(1)
+	service._active.Add(1)
+	service._jobs[entry._job.Id] = entry
+	return nil
+}
+
+func (service *DefaultJobService) release(entry *jobEntry) {
+	entry._wg.Done()
+	service._active.Done()
+}
+
+// Shutdown stops accepting new jobs and waits for running ones to finish.
+// Delayed jobs that have not started yet, and jobs still running when ctx
+// ends, are cancelled and their ids returned.
+func (service *DefaultJobService) Shutdown(ctx context.Context) ([]string, error) {
+	service._lock.Lock()
+	if !service._closed {
+		service._closed = true
+		close(service._closing)
+	}
+	scheduled := []*jobEntry{}
+	for _, entry := range service._jobs {
+		if entry._scheduled {
+			scheduled = append(scheduled, entry)
+		}
+	}
+	service._lock.Unlock()
+	ids := []string{}
+	for _, entry := range scheduled {
+		entry._cancel()
+		service.unqueue(entry)
+		service.finish(entry, nil)
+		ids = append(ids, entry._job.Id)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		service._active.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		sort.Strings(ids)
+		return ids, nil
+	case <-ctx.Done():
+	}
+
+	service._lock.Lock()
+	abandoned := make([]*jobEntry, 0, len(service._jobs))
+	for _, entry := range service._jobs {
+		abandoned = append(abandoned, entry)
+	}
+	service._lock.Unlock()
+	for _, entry := range abandoned {
+		entry._cancel()
+		service.unqueue(entry)
+		service.finish(entry, nil)
+		ids = append(ids, entry._job.Id)
+	}
+	sort.Strings(ids)
+	return ids, ctx.Err()
+}
+
+func (service *DefaultJobService) finish(entry *jobEntry, err error) {
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	if service._jobs[entry._job.Id] == entry {
+		delete(service._jobs, entry._job.Id)
+		if err != nil {
+			now := service._clock.Now()
+			for id, failedAt := range service._failed {
+				if now.Sub(failedAt) >= jobFailedRetention {
+					delete(service._failed, id)
+				}
+			}
+			service._failed[entry._job.Id] = now
+		}
+	}
+	for _, subscriber := range entry._subscribers {
+		close(subscriber)
+	}
+	entry._subscribers = nil
 }
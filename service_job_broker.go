@@ -0,0 +1,543 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JobMessage struct {
+	Id         string    `json:"id"`
+	Type       string    `json:"type"`
+	Payload    []byte    `json:"payload"`
+	Attempts   int       `json:"attempts"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	Receipt    string    `json:"-"`
+}
+
+// JobBroker is a queue shared between processes with at-least-once delivery.
+// A received message stays invisible to other consumers for the visibility
+// timeout and is delivered again unless acknowledged with its receipt.
+// Extend pushes the timeout of a message still in flight to visibility from
+// now and returns the receipt to use for it from then on.
+type JobBroker interface {
+	Publish(message *JobMessage) error
+	Receive(visibility time.Duration) (*JobMessage, error)
+	Extend(receipt string, visibility time.Duration) (string, error)
+	Ack(receipt string) error
+	Nack(receipt string) error
+}
+
+type JobConsumerOptions struct {
+	Concurrency  int
+	Visibility   time.Duration
+	PollInterval time.Duration
+	MaxAttempts  int
+}
+
+type MemoryJobBroker struct {
+	_lock     sync.Mutex
+	_clock    Clock
+	_ready    []*JobMessage
+	_inflight map[string]*memoryDelivery
+}
+
+type memoryDelivery struct {
+	_message  *JobMessage
+	_deadline time.Time
+}
+
+func NewMemoryJobBroker(clock ...Clock) *MemoryJobBroker {
+	broker := &MemoryJobBroker{
+		_clock:    GetSystemClock(),
+		_inflight: make(map[string]*memoryDelivery),
+	}
+	if len(clock) > 0 {
+		broker._clock = clock[0]
+	}
+	return broker
+}
+
+func (broker *MemoryJobBroker) Publish(message *JobMessage) error {
+	if message == nil || message.Id == "" {
+		return fmt.Errorf("job message has no id")
+	}
+	copied := *message
+	broker._lock.Lock()
+	defer broker._lock.Unlock()
+	if copied.EnqueuedAt.IsZero() {
+		copied.EnqueuedAt = broker._clock.Now()
+	}
+	broker._ready = append(broker._ready, &copied)
+	return nil
+}
+
+func (broker *MemoryJobBroker) Receive(visibility time.Duration) (*JobMessage, error) {
+	broker._lock.Lock()
+	defer broker._lock.Unlock()
+	now := broker._clock.Now()
+	expired := []string{}
+	for receipt, delivery := range broker._inflight {
+		if !now.Before(delivery._deadline) {
+			expired = append(expired, receipt)
+		}
+	}
+	sort.Strings(expired)
+	for _, receipt := range expired {
+		broker._ready = append(broker._ready, broker._inflight[receipt]._message)
+		delete(broker._inflight, receipt)
+	}
+	if len(broker._ready) == 0 {
+		return nil, nil
+	}
+	message := broker._ready[0]
+	broker._ready = broker._ready[1:]
+	message.Attempts++
+	receipt := uuid.NewString()
+	broker._inflight[receipt] = &memoryDelivery{_message: message, _deadline: now.Add(visibility)}
+	delivered := *message
+	delivered.Receipt = receipt
+	return &delivered, nil
+}
+
+func (broker *MemoryJobBroker) Extend(receipt string, visibility time.Duration) (string, error) {
+	broker._lock.Lock()
+	defer broker._lock.Unlock()
+	delivery, ok := broker._inflight[receipt]
+	if !ok {
+		return "", fmt.Errorf("job message receipt '%s' is not in flight", receipt)
+	}
+	delivery._deadline = broker._clock.Now().Add(visibility)
+	return receipt, nil
+}
+
+func (broker *MemoryJobBroker) Ack(receipt string) error {
+	broker._lock.Lock()
+	defer broker._lock.Unlock()
+	if _, ok := broker._inflight[receipt]; !ok {
+		return fmt.Errorf("job message receipt '%s' is not in flight", receipt)
+	}
+	delete(broker._inflight, receipt)
+	return nil
+}
+
+func (broker *MemoryJobBroker) Nack(receipt string) error {
+	broker._lock.Lock()
+	defer broker._lock.Unlock()
+	delivery, ok := broker._inflight[receipt]
+	if !ok {
+		return fmt.Errorf("job message receipt '%s' is not in flight", receipt)
+	}
+	delete(broker._inflight, receipt)
+	broker._ready = append(broker._ready, delivery._message)
+	return nil
+}
+
+// FileJobBroker shares a queue between processes through a directory.
+// Messages wait in "ready" and are claimed by atomically renaming them into
+// "inflight", with the visibility deadline encoded in the file name.
+type FileJobBroker struct {
+	_dir   string
+	_clock Clock
+}
+
+func NewFileJobBroker(dir string, clock ...Clock) (*FileJobBroker, error) {
+	for _, sub := range []string{"ready", "inflight"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	broker := &FileJobBroker{_dir: dir, _clock: GetSystemClock()}
+	if len(clock) > 0 {
+		broker._clock = clock[0]
+	}
+	return broker, nil
+}
+
+func (broker *FileJobBroker) Publish(message *JobMessage) error {
+	if message == nil || message.Id == "" {
+		return fmt.Errorf("job message has no id")
+	}
+	copied := *message
+	if copied.EnqueuedAt.IsZero() {
+		copied.EnqueuedAt = broker._clock.Now()
+	}
+	content, err := json.Marshal(&copied)
+	if err != nil {
+		return err
+	}
+	return write_file_atomic(broker.readyPath(copied.Id), content)
+}
+
+func (broker *FileJobBroker) Receive(visibility time.Duration) (*JobMessage, error) {
+	now := broker._clock.Now()
+	if err := broker.requeueExpired(now); err != nil {
+		return nil, err
+	}
+	names, err := broker.list("ready")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		id := name[strings.Index(name, "-")+1 : len(name)-len(".json")]
+		receipt := fmt.Sprintf("%020d-%s.json", now.Add(visibility).UnixNano(), id)
+		claimed := filepath.Join(broker._dir, "inflight", receipt)
+		err := os.Rename(filepath.Join(broker._dir, "ready", name), claimed)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		content, err := os.ReadFile(claimed)
+		if err != nil {
+			return nil, err
+		}
+		message := &JobMessage{}
+		if err = json.Unmarshal(content, message); err != nil {
+			return nil, fmt.Errorf("corrupt job message '%s': %v", name, err)
+		}
+		message.Attempts++
+		if content, err = json.Marshal(message); err != nil {
+			return nil, err
+		}
+		if err = write_file_atomic(claimed, content); err != nil {
+			return nil, err
+		}
+		message.Receipt = receipt
+		return message, nil
+	}
+	return nil, nil
+}
+
+func (broker *FileJobBroker) Extend(receipt string, visibility time.Duration) (string, error) {
+	name, id, ok := parseReceipt(receipt)
+	if !ok {
+		return "", fmt.Errorf("job message receipt '%s' is not in flight", receipt)
+	}
+	extended := fmt.Sprintf("%020d-%s.json", broker._clock.Now().Add(visibility).UnixNano(), id)
+	err := os.Rename(filepath.Join(broker._dir, "inflight", name), filepath.Join(broker._dir, "inflight", extended))
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("job message receipt '%s' is not in flight", receipt)
+	} else if err != nil {
+		return "", err
+	}
+	return extended, nil
+}
+
+func (broker *FileJobBroker) Ack(receipt string) error {
+	name, _, ok := parseReceipt(receipt)
+	if !ok {
+		return fmt.Errorf("job message receipt '%s' is not in flight", receipt)
+	}
+	err := os.Remove(filepath.Join(broker._dir, "inflight", name))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("job message receipt '%s' is not in flight", receipt)
+	}
+	return err
+}
+
+func (broker *FileJobBroker) Nack(receipt string) error {
+	name, id, ok := parseReceipt(receipt)
+	if !ok {
+		return fmt.Errorf("job message receipt '%s' is not in flight", receipt)
+	}
+	err := os.Rename(filepath.Join(broker._dir, "inflight", name), broker.readyPath(id))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("job message receipt '%s' is not in flight", receipt)
+	}
+	return err
+}
+
+// parseReceipt returns the file name of a receipt and the message id in it,
+// which follows the deadline as in "<deadline>-<id>.json".
+func parseReceipt(receipt string) (string, string, bool) {
+	name := filepath.Base(receipt)
+	dash := strings.Index(name, "-")
+	if dash < 0 || !strings.HasSuffix(name, ".json") || dash+1 >= len(name)-len(".json") {
+		return "", "", false
+	}
+	return name, name[dash+1 : len(name)-len(".json")], true
+}
+
+func (broker *FileJobBroker) requeueExpired(now time.Time) error {
+	names, err := broker.list("inflight")
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		dash := strings.Index(name, "-")
+		deadline, err := strconv.ParseInt(name[:dash], 10, 64)
+		if err != nil || now.UnixNano() < deadline {
+			continue
+		}
+		err = os.Rename(filepath.Join(broker._dir, "inflight", name), broker.readyPath(name[dash+1:len(name)-len(".json")]))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (broker *FileJobBroker) readyPath(id string) string {
+	name := fmt.Sprintf("%020d-%s.json", broker._clock.Now().UnixNano(), filepath.Base(id))
+	return filepath.Join(broker._dir, "ready", name)
+}
+
+func (broker *FileJobBroker) list(sub string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(broker._dir, sub))
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasSuffix(name, ".json") && strings.Contains(name, "-") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// brokered tells whether a job is run by consumers of the broker rather than
+// by this process.
+func (service *DefaultJobService) brokered(job *Job) bool {
+	return job != nil && service._broker != nil && job.Type != "" && job.Action == nil && job.ContextAction == nil
+}
+
+func (service *DefaultJobService) sendToBroker(job *Job) error {
+	if service.isClosed() {
+		return ErrJobServiceClosed
+	}
+	service.emit(JobEvent{Type: JOB_EVENT_ENQUEUED, Job: job})
+	return service.publishJob(job)
+}
+
+func (service *DefaultJobService) publishJob(job *Job) error {
+	return service._broker.Publish(&JobMessage{
+		Id:      job.Id,
+		Type:    job.Type,
+		Payload: job.Payload,
+	})
+}
+
+// Consume runs handler jobs received from the broker until ctx is done or
+// the service shuts down. Messages are acknowledged once their job succeeds,
+// and handed back to the broker when it fails, until MaxAttempts is reached.
+// Their visibility timeout is extended while the job runs. Consume also
+// returns when the broker fails to settle or extend a message.
+func (service *DefaultJobService) Consume(ctx context.Context, options ...JobConsumerOptions) error {
+	if service._broker == nil {
+		return fmt.Errorf("job service has no broker")
+	}
+	opts := JobConsumerOptions{}
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.Visibility <= 0 {
+		opts.Visibility = 30 * time.Second
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	slots := make(chan struct{}, opts.Concurrency)
+	failures := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case failures <- err:
+		default:
+		}
+	}
+	var lock sync.Mutex
+	leases := make(map[string]*brokerLease)
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-service._closing:
+			return ErrJobServiceClosed
+		case err := <-failures:
+			return err
+		}
+		if service.isClosed() {
+			<-slots
+			return ErrJobServiceClosed
+		}
+		message, err := service._broker.Receive(opts.Visibility)
+		if err != nil {
+			<-slots
+			return err
+		} else if message == nil {
+			<-slots
+			if err = service.idle(ctx, opts.PollInterval, failures); err != nil {
+				return err
+			}
+			continue
+		}
+
+		lock.Lock()
+		lease, leased := leases[message.Id]
+		lock.Unlock()
+		if leased || service.isRunning(message.Id) {
+			// The job is still running from an earlier delivery whose receipt
+			// has expired. It settles the message under the new receipt;
+			// messages of other running jobs come back after the timeout.
+			if leased {
+				lease.adopt(message.Receipt)
+			}
+			<-slots
+			continue
+		}
+		lease = &brokerLease{
+			_broker:     service._broker,
+			_clock:      service._clock,
+			_visibility: opts.Visibility,
+			_receipt:    message.Receipt,
+			_fail:       fail,
+		}
+		lock.Lock()
+		leases[message.Id] = lease
+		lock.Unlock()
+		lease.renew()
+		attempts := message.Attempts
+		settle := func(err error) {
+			lock.Lock()
+			delete(leases, message.Id)
+			lock.Unlock()
+			receipt := lease.end()
+			if err == nil || (opts.MaxAttempts > 0 && attempts >= opts.MaxAttempts) {
+				err = service._broker.Ack(receipt)
+			} else {
+				err = service._broker.Nack(receipt)
+			}
+			if err != nil {
+				fail(err)
+			}
+			<-slots
+		}
+		job := &Job{
+			Id:      message.Id,
+			Type:    message.Type,
+			Payload: message.Payload,
+			Callback: func(jobId string, result any, err error) {
+				settle(err)
+			},
+		}
+		if message.Attempts > 1 {
+			service.emit(JobEvent{Type: JOB_EVENT_RETRIED, Job: job, Attempts: message.Attempts - 1})
+		}
+		if err = service.start(job, nil, false); errors.Is(err, ErrJobServiceClosed) {
+			lock.Lock()
+			delete(leases, message.Id)
+			lock.Unlock()
+			<-slots
+			return errors.Join(err, service._broker.Nack(lease.end()))
+		} else if err != nil {
+			// Messages that cannot be started, e.g. for lack of a handler, are
+			// settled like failed jobs so they do not hold up the queue.
+			settle(err)
+		}
+	}
+}
+
+// idle waits for the poll interval between empty receives.
+func (service *DefaultJobService) idle(ctx context.Context, d time.Duration, failures <-chan error) error {
+	elapsed := make(chan struct{})
+	timer := service._clock.AfterFunc(d, func() { close(elapsed) })
+	defer timer.Stop()
+	select {
+	case <-elapsed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-service._closing:
+		return ErrJobServiceClosed
+	case err := <-failures:
+		return err
+	}
+}
+
+func (service *DefaultJobService) isClosed() bool {
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	return service._closed
+}
+
+func (service *DefaultJobService) isRunning(id string) bool {
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	_, ok := service._jobs[id]
+	return ok
+}
+
+// brokerLease keeps a received message invisible to other consumers while
+// its job runs, extending the timeout halfway through each period.
+type brokerLease struct {
+	_lock       sync.Mutex
+	_broker     JobBroker
+	_clock      Clock
+	_visibility time.Duration
+	_receipt    string
+	_timer      ClockTimer
+	_ended      bool
+	_fail       func(err error)
+}
+
+func (lease *brokerLease) renew() {
+	lease._lock.Lock()
+	defer lease._lock.Unlock()
+	if lease._ended {
+		return
+	}
+	lease._timer = lease._clock.AfterFunc(lease._visibility/2, lease.extend)
+}
+
+func (lease *brokerLease) extend() {
+	lease._lock.Lock()
+	if lease._ended {
+		lease._lock.Unlock()
+		return
+	}
+	receipt, err := lease._broker.Extend(lease._receipt, lease._visibility)
+	if err == nil {
+		lease._receipt = receipt
+	}
+	lease._lock.Unlock()
+	if err != nil {
+		lease._fail(err)
+		return
+	}
+	lease.renew()
+}
+
+// adopt switches to the receipt of a later delivery of the same message.
+func (lease *brokerLease) adopt(receipt string) {
+	lease._lock.Lock()
+	defer lease._lock.Unlock()
+	lease._receipt = receipt
+}
+
+// end stops extending the timeout and returns the receipt to settle with.
+func (lease *brokerLease) end() string {
+	lease._lock.Lock()
+	defer lease._lock.Unlock()
+	lease._ended = true
+	if lease._timer != nil {
+		lease._timer.Stop()
+	}
+	return lease._receipt
+}
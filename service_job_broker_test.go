@@ -0,0 +1,248 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testJobBroker(t *testing.T, clock *FakeClock, producer JobBroker, consumer JobBroker) {
+	assert.Nil(t, producer.Publish(&JobMessage{Id: "job1", Type: "email", Payload: []byte(`"a"`)}))
+	clock.Advance(time.Millisecond)
+	assert.Nil(t, producer.Publish(&JobMessage{Id: "job2", Type: "email"}))
+	assert.NotNil(t, producer.Publish(&JobMessage{}))
+
+	first, err := consumer.Receive(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, "job1", first.Id)
+	assert.Equal(t, `"a"`, string(first.Payload))
+	assert.Equal(t, 1, first.Attempts)
+
+	second, err := producer.Receive(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, "job2", second.Id)
+	none, err := consumer.Receive(time.Minute)
+	assert.Nil(t, err)
+	assert.Nil(t, none)
+
+	assert.Nil(t, consumer.Ack(second.Receipt))
+	assert.NotNil(t, consumer.Ack(second.Receipt))
+
+	clock.Advance(time.Minute)
+	redelivered, err := producer.Receive(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, "job1", redelivered.Id)
+	assert.Equal(t, 2, redelivered.Attempts)
+	assert.NotNil(t, consumer.Ack(first.Receipt))
+
+	assert.Nil(t, consumer.Nack(redelivered.Receipt))
+	again, err := consumer.Receive(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, again.Attempts)
+	assert.Nil(t, consumer.Ack(again.Receipt))
+	for _, receipt := range []string{"x", "-.json", "1-job1.txt", ""} {
+		assert.NotNil(t, consumer.Ack(receipt))
+		assert.NotNil(t, consumer.Nack(receipt))
+	}
+
+	none, err = consumer.Receive(time.Minute)
+	assert.Nil(t, err)
+	assert.Nil(t, none)
+
+	assert.Nil(t, producer.Publish(&JobMessage{Id: "job3", Type: "email"}))
+	third, err := consumer.Receive(time.Minute)
+	assert.Nil(t, err)
+	receipt, err := consumer.Extend(third.Receipt, 2*time.Minute)
+	assert.Nil(t, err)
+	clock.Advance(time.Minute)
+	none, err = producer.Receive(time.Minute)
+	assert.Nil(t, err)
+	assert.Nil(t, none)
+	assert.Nil(t, consumer.Ack(receipt))
+	_, err = consumer.Extend(receipt, time.Minute)
+	assert.NotNil(t, err)
+}
+
+func TestMemoryJobBroker(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	broker := NewMemoryJobBroker(clock)
+	testJobBroker(t, clock, broker, broker)
+}
+
+func TestFileJobBroker(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	dir := t.TempDir()
+	producer, err := NewFileJobBroker(dir, clock)
+	assert.Nil(t, err)
+	consumer, err := NewFileJobBroker(dir, clock)
+	assert.Nil(t, err)
+	testJobBroker(t, clock, producer, consumer)
+}
+
+func TestConsumeBrokeredJobs(t *testing.T) {
+	broker := NewMemoryJobBroker()
+	producer := GetJobService(JobServiceOptions{Broker: broker})
+	consumer := GetJobService(JobServiceOptions{Broker: broker})
+	results := make(chan string, 2)
+	attempts := 0
+	consumer.RegisterHandler("greet", func(payload []byte) (result any, err error) {
+		var name string
+		json.Unmarshal(payload, &name)
+		attempts++
+		if name == "flaky" && attempts == 1 {
+			return nil, errors.New("try again")
+		}
+		results <- name
+		return nil, nil
+	})
+
+	job, _ := NewHandlerJob("greet", "flaky", nil)
+	assert.Nil(t, producer.Start(job))
+	job, _ = NewHandlerJob("greet", "abebe", nil)
+	assert.Nil(t, producer.Start(job))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	consumed := make(chan error)
+	go func() {
+		consumed <- consumer.Consume(ctx, JobConsumerOptions{PollInterval: time.Millisecond})
+	}()
+	received := []string{<-results, <-results}
+	cancel()
+
+	assert.Equal(t, context.Canceled, <-consumed)
+	assert.ElementsMatch(t, []string{"flaky", "abebe"}, received)
+	message, _ := broker.Receive(time.Minute)
+	assert.Nil(t, message)
+}
+
+func TestConsumeSkipsUnhandledTypes(t *testing.T) {
+	broker := NewMemoryJobBroker()
+	consumer := GetJobService(JobServiceOptions{Broker: broker})
+	results := make(chan string, 1)
+	consumer.RegisterHandler("greet", func(payload []byte) (result any, err error) {
+		results <- string(payload)
+		return nil, nil
+	})
+	assert.Nil(t, broker.Publish(&JobMessage{Id: "unknown", Type: "unknown"}))
+	assert.Nil(t, broker.Publish(&JobMessage{Id: "greet", Type: "greet", Payload: []byte("abebe")}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	consumed := make(chan error)
+	go func() {
+		consumed <- consumer.Consume(ctx, JobConsumerOptions{PollInterval: time.Millisecond, MaxAttempts: 1})
+	}()
+	assert.Equal(t, "abebe", <-results)
+	cancel()
+
+	assert.Equal(t, context.Canceled, <-consumed)
+	message, _ := broker.Receive(time.Minute)
+	assert.Nil(t, message)
+}
+
+func TestConsumeWithoutBroker(t *testing.T) {
+	assert.NotNil(t, GetJobService().Consume(context.Background()))
+}
+
+func TestConsumeExtendsVisibilityOfLongJobs(t *testing.T) {
+	broker := NewMemoryJobBroker()
+	service := GetJobService(JobServiceOptions{Broker: broker})
+	var runs int32
+	done := make(chan bool)
+	service.RegisterHandler("slow", func(payload []byte) (result any, err error) {
+		atomic.AddInt32(&runs, 1)
+		time.Sleep(300 * time.Millisecond)
+		done <- true
+		return nil, nil
+	})
+	job, _ := NewHandlerJob("slow", nil, nil)
+	assert.Nil(t, service.Start(job))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	consumed := make(chan error)
+	go func() {
+		consumed <- service.Consume(ctx, JobConsumerOptions{
+			Concurrency:  2,
+			Visibility:   100 * time.Millisecond,
+			PollInterval: 10 * time.Millisecond,
+		})
+	}()
+	<-done
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+
+	assert.Equal(t, context.Canceled, <-consumed)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+	message, _ := broker.Receive(time.Minute)
+	assert.Nil(t, message)
+}
+
+func TestConsumeStopsOnShutdown(t *testing.T) {
+	service := GetJobService(JobServiceOptions{Broker: NewMemoryJobBroker()})
+	consumed := make(chan error)
+	go func() {
+		consumed <- service.Consume(context.Background(), JobConsumerOptions{PollInterval: time.Hour})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	_, err := service.Shutdown(context.Background())
+	assert.Nil(t, err)
+
+	assert.Equal(t, ErrJobServiceClosed, <-consumed)
+}
+
+type failingAckBroker struct {
+	*MemoryJobBroker
+}
+
+func (broker *failingAckBroker) Ack(receipt string) error {
+	return errors.New("ack failed")
+}
+
+func TestConsumeReturnsSettleErrors(t *testing.T) {
+	broker := &failingAckBroker{NewMemoryJobBroker()}
+	service := GetJobService(JobServiceOptions{Broker: broker})
+	service.RegisterHandler("greet", func(payload []byte) (result any, err error) { return nil, nil })
+	job, _ := NewHandlerJob("greet", nil, nil)
+	assert.Nil(t, service.Start(job))
+
+	err := service.Consume(context.Background(), JobConsumerOptions{PollInterval: time.Millisecond})
+	assert.Equal(t, "ack failed", err.Error())
+}
+
+func TestConsumeKeepsRunningMessagesInvisible(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	broker := NewMemoryJobBroker(clock)
+	service := GetJobService(JobServiceOptions{Broker: broker, Clock: clock})
+	started := make(chan bool)
+	release := make(chan bool)
+	service.RegisterHandler("slow", func(payload []byte) (result any, err error) {
+		started <- true
+		<-release
+		return nil, nil
+	})
+	job, _ := NewHandlerJob("slow", nil, nil)
+	assert.Nil(t, service.Start(job))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	consumed := make(chan error)
+	go func() {
+		consumed <- service.Consume(ctx, JobConsumerOptions{Visibility: time.Minute})
+	}()
+	<-started
+	clock.Advance(5 * time.Minute)
+	message, err := broker.Receive(time.Minute)
+	assert.Nil(t, err)
+	assert.Nil(t, message)
+
+	release <- true
+	service.Wait(job.Id)
+	cancel()
+	assert.Equal(t, context.Canceled, <-consumed)
+	clock.Advance(5 * time.Minute)
+	message, _ = broker.Receive(time.Minute)
+	assert.Nil(t, message)
+}
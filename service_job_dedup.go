@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	JOB_DEDUP_REJECT = iota
+	JOB_DEDUP_ATTACH
+)
+
+var ErrDuplicateJob = errors.New("duplicate job")
+
+type jobKey struct {
+	_jobId      string
+	_running    bool
+	_result     any
+	_err        error
+	_finishedAt time.Time
+	_callbacks  []JobCompleteCallback
+}
+
+// claimKey reserves job.Key for the job. When the key is taken by a running
+// job, or one that finished within the dedup window, the job is either
+// rejected or attached to it depending on the dedup policy.
+func (service *DefaultJobService) claimKey(job *Job) (bool, error) {
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	now := service._clock.Now()
+	for key, existing := range service._keys {
+		if !existing._running && now.Sub(existing._finishedAt) >= service._dedupWindow {
+			delete(service._keys, key)
+		}
+	}
+	existing, ok := service._keys[job.Key]
+	if !ok {
+		service._keys[job.Key] = &jobKey{_jobId: job.Id, _running: true}
+		return false, nil
+	}
+	if service._dedupPolicy != JOB_DEDUP_ATTACH {
+		return false, fmt.Errorf("%w: key '%s' belongs to job '%s'", ErrDuplicateJob, job.Key, existing._jobId)
+	}
+	job.Id = existing._jobId
+	if existing._running {
+		if job.Callback != nil {
+			existing._callbacks = append(existing._callbacks, job.Callback)
+		}
+	} else {
+		go service.notify(job, existing._result, existing._err)
+	}
+	return true, nil
+}
+
+func (service *DefaultJobService) releaseKey(job *Job, result any, err error) {
+	if job.Key == "" {
+		return
+	}
+	service._lock.Lock()
+	existing, ok := service._keys[job.Key]
+	if !ok || existing._jobId != job.Id || !existing._running {
+		service._lock.Unlock()
+		return
+	}
+	callbacks := existing._callbacks
+	existing._callbacks = nil
+	existing._running = false
+	existing._result = result
+	existing._err = err
+	existing._finishedAt = service._clock.Now()
+	if service._dedupWindow <= 0 {
+		delete(service._keys, job.Key)
+	}
+	service._lock.Unlock()
+
+	for _, callback := range callbacks {
+		attached := *job
+		attached.Callback = callback
+		service.notify(&attached, result, err)
+	}
+}
+
+// abandonKey frees the key of a job that could not be started, so it does
+// not block retries for the dedup window.
+func (service *DefaultJobService) abandonKey(job *Job, err error) {
+	service.releaseKey(job, nil, err)
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	if existing, ok := service._keys[job.Key]; ok && existing._jobId == job.Id {
+		delete(service._keys, job.Key)
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func keyedJob(key string, release chan bool, results chan any) *Job {
+	job := NewJob(func() (result any, err error) {
+		if release != nil {
+			<-release
+		}
+		return "report", nil
+	}, func(jobId string, result any, err error) {
+		if results != nil {
+			results <- result
+		}
+	})
+	job.Key = key
+	return job
+}
+
+func TestDuplicateJobIsRejected(t *testing.T) {
+	service := GetJobService()
+	release := make(chan bool)
+	first := keyedJob("report:1", release, nil)
+	assert.Nil(t, service.Start(first))
+
+	err := service.Start(keyedJob("report:1", nil, nil))
+	assert.True(t, errors.Is(err, ErrDuplicateJob))
+	assert.Nil(t, service.Start(keyedJob("report:2", nil, nil)))
+
+	release <- true
+	service.Wait(first.Id)
+	assert.Nil(t, service.Start(keyedJob("report:1", nil, nil)))
+}
+
+func TestDuplicateJobAttachesToRunning(t *testing.T) {
+	service := GetJobService(JobServiceOptions{DedupPolicy: JOB_DEDUP_ATTACH})
+	release := make(chan bool)
+	results := make(chan any, 2)
+	first := keyedJob("report:1", release, results)
+	second := keyedJob("report:1", release, results)
+	assert.Nil(t, service.Start(first))
+	assert.Nil(t, service.Start(second))
+
+	assert.Equal(t, first.Id, second.Id)
+	release <- true
+	service.Wait(second.Id)
+	assert.Equal(t, "report", <-results)
+	assert.Equal(t, "report", <-results)
+}
+
+func TestDuplicateJobWindow(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	service := GetJobService(JobServiceOptions{
+		Clock:       clock,
+		DedupPolicy: JOB_DEDUP_ATTACH,
+		DedupWindow: time.Minute,
+	})
+	first := keyedJob("report:1", nil, nil)
+	assert.Nil(t, service.Start(first))
+	service.Wait(first.Id)
+
+	results := make(chan any, 1)
+	attached := keyedJob("report:1", nil, results)
+	assert.Nil(t, service.Start(attached))
+	assert.Equal(t, first.Id, attached.Id)
+	assert.Equal(t, "report", <-results)
+
+	clock.Advance(time.Minute)
+	fresh := keyedJob("report:1", nil, nil)
+	assert.Nil(t, service.Start(fresh))
+	assert.NotEqual(t, first.Id, fresh.Id)
+	service.Wait(fresh.Id)
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type JobInfo struct {
+	Id       string
+	Status   int
+	Type     string
+	Group    string
+	Priority int
+	RunAt    time.Time
+}
+
+// StartAt submits a job to run at the given time. Until then it is listed
+// with JOB_STATUS_SCHEDULED and can be cancelled with Stop. Jobs that Start
+// would send to the broker are sent when they are due.
+func (service *DefaultJobService) StartAt(job *Job, at time.Time) error {
+	if !at.After(service._clock.Now()) {
+		return service.Start(job)
+	} else if service.brokered(job) {
+		return service.sendAt(job, at)
+	}
+	entry, err := service.prepare(job, nil, false, at)
+	if err != nil {
+		return err
+	} else if entry == nil {
+		return nil
+	}
+	service.emit(JobEvent{Type: JOB_EVENT_ENQUEUED, Job: job})
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	if entry._scheduled {
+		entry._timer = service._clock.AfterFunc(at.Sub(service._clock.Now()), func() {
+			service._lock.Lock()
+			due := entry._scheduled
+			entry._scheduled = false
+			service._lock.Unlock()
+			if due {
+				service.admit(entry)
+			}
+		})
+	}
+	return nil
+}
+
+// sendAt holds a broker job in this process until it is due. Its callback
+// only runs if the job is stopped or cannot be published.
+func (service *DefaultJobService) sendAt(job *Job, at time.Time) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	entry := &jobEntry{_job: job, _cancel: cancel, _scheduled: true, _runAt: at}
+	if err := service.register(entry, false); err != nil {
+		cancel()
+		return err
+	}
+	persisted := service._store != nil
+	if persisted {
+		createdAt := job._createdAt
+		if createdAt.IsZero() {
+			createdAt = service._clock.Now()
+		}
+		err := service._store.Save(&JobRecord{
+			Id:        job.Id,
+			Type:      job.Type,
+			Payload:   job.Payload,
+			CreatedAt: createdAt,
+			RunAt:     at,
+		})
+		if err != nil {
+			cancel()
+			service.finish(entry, nil)
+			service.release(entry)
+			return err
+		}
+	}
+	entry._run = func() {
+		defer service.release(entry)
+		defer cancel()
+		err := ctx.Err()
+		if err == nil {
+			err = service.publishJob(job)
+		}
+		if err != nil {
+			service.notify(job, nil, err)
+		}
+		if persisted {
+			service._store.Delete(job.Id)
+		}
+		service.finish(entry, err)
+	}
+	service.emit(JobEvent{Type: JOB_EVENT_ENQUEUED, Job: job})
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	if entry._scheduled {
+		entry._timer = service._clock.AfterFunc(at.Sub(service._clock.Now()), func() {
+			service._lock.Lock()
+			due := entry._scheduled
+			entry._scheduled = false
+			service._lock.Unlock()
+			if due {
+				entry._run()
+			}
+		})
+	}
+	return nil
+}
+
+func (service *DefaultJobService) StartAfter(job *Job, delay time.Duration) error {
+	return service.StartAt(job, service._clock.Now().Add(delay))
+}
+
+func (service *DefaultJobService) List() []JobInfo {
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	result := make([]JobInfo, 0, len(service._jobs))
+	for id, entry := range service._jobs {
+		result = append(result, JobInfo{
+			Id:       id,
+			Status:   entry.status(),
+			Type:     entry._job.Type,
+			Group:    entry._job.Group,
+			Priority: entry._job.Priority,
+			RunAt:    entry._runAt,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return result
+}
+
+// status reports the state of a registered entry. Must hold the lock.
+func (entry *jobEntry) status() int {
+	if entry._scheduled {
+		return JOB_STATUS_SCHEDULED
+	} else if entry._queued || entry._throttled {
+		return JOB_STATUS_QUEUED
+	}
+	return JOB_STATUS_WORKING
+}
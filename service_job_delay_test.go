@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartAfter(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	service := GetJobService(JobServiceOptions{Clock: clock})
+	ran := make(chan bool, 1)
+	job := NewJob(func() (result any, err error) {
+		ran <- true
+		return nil, nil
+	}, nil)
+	job.Type = "reminder"
+
+	assert.Nil(t, service.StartAfter(job, time.Hour))
+	assert.Equal(t, JOB_STATUS_SCHEDULED, service.Status(job.Id))
+	list := service.List()
+	assert.Len(t, list, 1)
+	assert.Equal(t, job.Id, list[0].Id)
+	assert.Equal(t, JOB_STATUS_SCHEDULED, list[0].Status)
+	assert.Equal(t, "reminder", list[0].Type)
+	assert.Equal(t, time.Date(2026, 1, 1, 1, 0, 0, 0, time.UTC), list[0].RunAt)
+
+	clock.Advance(59 * time.Minute)
+	assert.Empty(t, ran)
+	clock.Advance(time.Minute)
+	service.Wait(job.Id)
+	assert.True(t, <-ran)
+	assert.Empty(t, service.List())
+}
+
+func TestStopDelayedJob(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	service := GetJobService(JobServiceOptions{Clock: clock})
+	errs := make(chan error, 1)
+	job := NewJob(func() (result any, err error) {
+		return "ran", nil
+	}, func(jobId string, result any, err error) {
+		errs <- err
+	})
+
+	assert.Nil(t, service.StartAt(job, clock.Now().Add(time.Hour)))
+	service.Stop(job.Id)
+	assert.Equal(t, context.Canceled, <-errs)
+	assert.Zero(t, clock.PendingTimers())
+	assert.Equal(t, JOB_STATUS_COMPLETE, service.Status(job.Id))
+}
+
+func TestStartAtInThePast(t *testing.T) {
+	service := GetJobService()
+	job := NewJob(func() (result any, err error) { return nil, nil }, nil)
+	assert.Nil(t, service.StartAt(job, time.Now().Add(-time.Hour)))
+	service.Wait(job.Id)
+	assert.Equal(t, JOB_STATUS_COMPLETE, service.Status(job.Id))
+}
+
+func TestShutdownAbandonsDelayedJobs(t *testing.T) {
+	service := GetJobService()
+	job := NewJob(func() (result any, err error) { return nil, nil }, nil)
+	assert.Nil(t, service.StartAfter(job, time.Hour))
+
+	abandoned, err := service.Shutdown(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{job.Id}, abandoned)
+}
+
+func TestResumeDelayedJob(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemoryJobStore()
+	store.Save(&JobRecord{Id: "later", Type: "noop", RunAt: clock.Now().Add(time.Hour)})
+	service := GetJobService(JobServiceOptions{Clock: clock, Store: store})
+	service.RegisterHandler("noop", func(payload []byte) (result any, err error) {
+		return nil, nil
+	})
+
+	_, err := service.Resume(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, JOB_STATUS_SCHEDULED, service.Status("later"))
+	clock.Advance(time.Hour)
+	service.Wait("later")
+	records, _ := store.List()
+	assert.Empty(t, records)
+}
+
+func TestStartAfterSendsHandlerJobsToBroker(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	broker := NewMemoryJobBroker(clock)
+	service := GetJobService(JobServiceOptions{Clock: clock, Broker: broker})
+	job, _ := NewHandlerJob("reminder", "abebe", nil)
+
+	assert.Nil(t, service.StartAfter(job, time.Hour))
+	assert.Equal(t, JOB_STATUS_SCHEDULED, service.Status(job.Id))
+	message, _ := broker.Receive(time.Minute)
+	assert.Nil(t, message)
+
+	clock.Advance(time.Hour)
+	service.Wait(job.Id)
+	message, err := broker.Receive(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, job.Id, message.Id)
+	assert.Equal(t, `"abebe"`, string(message.Payload))
+	assert.Nil(t, broker.Ack(message.Receipt))
+	assert.Empty(t, service.List())
+
+	errs := make(chan error, 1)
+	stopped, _ := NewHandlerJob("reminder", "kebede", func(jobId string, result any, err error) {
+		errs <- err
+	})
+	assert.Nil(t, service.StartAfter(stopped, time.Hour))
+	service.Stop(stopped.Id)
+	assert.Equal(t, context.Canceled, <-errs)
+	clock.Advance(time.Hour)
+	message, _ = broker.Receive(time.Minute)
+	assert.Nil(t, message)
+}
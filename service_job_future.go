@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Future is the typed result of a job started with StartTyped or Then.
+// Futures built by All and Any do not run a job and have an empty JobId.
+type Future[T any] struct {
+	JobId          string
+	_lock          sync.Mutex
+	_service       JobService
+	_done          chan struct{}
+	_resolved      bool
+	_value         T
+	_err           error
+	_continuations []func()
+}
+
+func newFuture[T any](service JobService, jobId string) *Future[T] {
+	return &Future[T]{
+		JobId:    jobId,
+		_service: service,
+		_done:    make(chan struct{}),
+	}
+}
+
+func StartTyped[T any](service JobService, action func(ctx *JobContext) (T, error)) *Future[T] {
+	job, future := newTypedJob(service, action)
+	if err := service.Start(job); err != nil {
+		future.resolve(*new(T), err)
+	}
+	return future
+}
+
+// Then runs next as a new job once future succeeds. A failed future skips
+// next and passes its error along.
+func Then[T any, U any](future *Future[T], next func(ctx *JobContext, value T) (U, error)) *Future[U] {
+	job, result := newTypedJob(future._service, func(ctx *JobContext) (U, error) {
+		return next(ctx, future._value)
+	})
+	future.onDone(func() {
+		if future._err != nil {
+			result.resolve(*new(U), future._err)
+		} else if err := future._service.Start(job); err != nil {
+			result.resolve(*new(U), err)
+		}
+	})
+	return result
+}
+
+// All resolves with every value in order, or with the first error.
+func All[T any](futures ...*Future[T]) *Future[[]T] {
+	result := newFuture[[]T](nil, "")
+	if len(futures) == 0 {
+		result.resolve([]T{}, nil)
+		return result
+	}
+	var lock sync.Mutex
+	remaining := len(futures)
+	for _, future := range futures {
+		future := future
+		future.onDone(func() {
+			if future._err != nil {
+				result.resolve(nil, future._err)
+				return
+			}
+			lock.Lock()
+			remaining--
+			last := remaining == 0
+			lock.Unlock()
+			if last {
+				values := make([]T, len(futures))
+				for i := range futures {
+					values[i] = futures[i]._value
+				}
+				result.resolve(values, nil)
+			}
+		})
+	}
+	return result
+}
+
+// Any resolves with the first successful value, or with all errors joined
+// when every future fails.
+func Any[T any](futures ...*Future[T]) *Future[T] {
+	result := newFuture[T](nil, "")
+	if len(futures) == 0 {
+		result.resolve(*new(T), errors.New("no futures to wait for"))
+		return result
+	}
+	var lock sync.Mutex
+	errs := make([]error, len(futures))
+	remaining := len(futures)
+	for i, future := range futures {
+		i, future := i, future
+		future.onDone(func() {
+			if future._err == nil {
+				result.resolve(future._value, nil)
+				return
+			}
+			lock.Lock()
+			errs[i] = future._err
+			remaining--
+			last := remaining == 0
+			lock.Unlock()
+			if last {
+				result.resolve(*new(T), errors.Join(errs...))
+			}
+		})
+	}
+	return result
+}
+
+func (future *Future[T]) Await(ctx context.Context) (T, error) {
+	select {
+	case <-future._done:
+		return future._value, future._err
+	case <-ctx.Done():
+		return *new(T), ctx.Err()
+	}
+}
+
+func (future *Future[T]) Done() <-chan struct{} {
+	return future._done
+}
+
+func newTypedJob[T any](service JobService, action func(ctx *JobContext) (T, error)) (*Job, *Future[T]) {
+	job := NewContextJob(func(ctx *JobContext) (result any, err error) {
+		return action(ctx)
+	}, nil)
+	future := newFuture[T](service, job.Id)
+	job.Callback = func(jobId string, result any, err error) {
+		value, _ := result.(T)
+		future.resolve(value, err)
+	}
+	return job, future
+}
+
+func (future *Future[T]) resolve(value T, err error) {
+	future._lock.Lock()
+	if future._resolved {
+		future._lock.Unlock()
+		return
+	}
+	future._resolved = true
+	future._value = value
+	future._err = err
+	continuations := future._continuations
+	future._continuations = nil
+	close(future._done)
+	future._lock.Unlock()
+
+	for _, continuation := range continuations {
+		continuation()
+	}
+}
+
+func (future *Future[T]) onDone(continuation func()) {
+	future._lock.Lock()
+	if !future._resolved {
+		future._continuations = append(future._continuations, continuation)
+		future._lock.Unlock()
+		return
+	}
+	future._lock.Unlock()
+	continuation()
+}
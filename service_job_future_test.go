@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartTyped(t *testing.T) {
+	service := GetJobService()
+	future := StartTyped(service, func(ctx *JobContext) (int, error) {
+		return 42, nil
+	})
+	assert.NotEmpty(t, future.JobId)
+
+	value, err := future.Await(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 42, value)
+	assert.Equal(t, JOB_STATUS_COMPLETE, service.Status(future.JobId))
+}
+
+func TestStartTypedFailure(t *testing.T) {
+	future := StartTyped(GetJobService(), func(ctx *JobContext) (string, error) {
+		return "", errors.New("failed")
+	})
+	_, err := future.Await(context.Background())
+	assert.Equal(t, "failed", err.Error())
+}
+
+func TestFutureAwaitTimeout(t *testing.T) {
+	release := make(chan bool)
+	future := StartTyped(GetJobService(), func(ctx *JobContext) (int, error) {
+		<-release
+		return 1, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := future.Await(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	release <- true
+}
+
+func TestFutureThen(t *testing.T) {
+	service := GetJobService()
+	future := Then(StartTyped(service, func(ctx *JobContext) (int, error) {
+		return 7, nil
+	}), func(ctx *JobContext, value int) (string, error) {
+		return "#" + strconv.Itoa(value), nil
+	})
+
+	value, err := future.Await(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "#7", value)
+
+	called := false
+	failed := Then(StartTyped(service, func(ctx *JobContext) (int, error) {
+		return 0, errors.New("first failed")
+	}), func(ctx *JobContext, value int) (int, error) {
+		called = true
+		return value, nil
+	})
+	_, err = failed.Await(context.Background())
+	assert.Equal(t, "first failed", err.Error())
+	assert.False(t, called)
+}
+
+func TestFutureAll(t *testing.T) {
+	service := GetJobService()
+	futures := []*Future[int]{}
+	for i := 0; i < 3; i++ {
+		i := i
+		futures = append(futures, StartTyped(service, func(ctx *JobContext) (int, error) {
+			return i * 10, nil
+		}))
+	}
+	values, err := All(futures...).Await(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0, 10, 20}, values)
+
+	futures = append(futures, StartTyped(service, func(ctx *JobContext) (int, error) {
+		return 0, errors.New("one failed")
+	}))
+	_, err = All(futures...).Await(context.Background())
+	assert.Equal(t, "one failed", err.Error())
+}
+
+func TestFutureAny(t *testing.T) {
+	service := GetJobService()
+	release := make(chan bool)
+	slow := StartTyped(service, func(ctx *JobContext) (string, error) {
+		<-release
+		return "slow", nil
+	})
+	failed := StartTyped(service, func(ctx *JobContext) (string, error) {
+		return "", errors.New("failed")
+	})
+	fast := StartTyped(service, func(ctx *JobContext) (string, error) {
+		return "fast", nil
+	})
+
+	value, err := Any(slow, failed, fast).Await(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "fast", value)
+	release <- true
+
+	_, err = Any(failed, failed).Await(context.Background())
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,303 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const (
+	JOB_GRAPH_FAIL_FAST = iota
+	JOB_GRAPH_CONTINUE_ON_ERROR
+)
+
+var ErrJobSkipped = errors.New("job skipped")
+
+type JobGraphCallback = func(results map[string]any, errs map[string]error)
+
+type JobGraphOptions struct {
+	Policy         int
+	Callback       JobGraphCallback
+	MaxConcurrency int
+}
+
+type jobGraph struct {
+	_lock       sync.Mutex
+	_service    *DefaultJobService
+	_entry      *jobEntry
+	_options    JobGraphOptions
+	_jobs       map[string]*Job
+	_waiting    map[string]int
+	_dependents map[string][]string
+	_running    map[string]bool
+	_results    map[string]any
+	_errs       map[string]error
+	_halted     bool
+	_ready      []*Job
+}
+
+// StartGraph runs jobs in dependency order, as declared by their DependsOn
+// ids. Independent jobs run concurrently. The returned id can be passed to
+// Status, Wait and Stop to track or cancel the graph as a whole.
+func (service *DefaultJobService) StartGraph(jobs []*Job, options ...JobGraphOptions) (string, error) {
+	graph := &jobGraph{
+		_service:    service,
+		_jobs:       make(map[string]*Job),
+		_waiting:    make(map[string]int),
+		_dependents: make(map[string][]string),
+		_running:    make(map[string]bool),
+		_results:    make(map[string]any),
+		_errs:       make(map[string]error),
+	}
+	if len(options) > 0 {
+		graph._options = options[0]
+	}
+	for _, job := range jobs {
+		if job == nil {
+			return "", fmt.Errorf("job is nil")
+		} else if _, ok := graph._jobs[job.Id]; ok {
+			return "", fmt.Errorf("duplicate job id '%s' in graph", job.Id)
+		}
+		graph._jobs[job.Id] = job
+	}
+	for _, job := range jobs {
+		for _, dep := range job.DependsOn {
+			if _, ok := graph._jobs[dep]; !ok {
+				return "", fmt.Errorf("job '%s' depends on unknown job '%s'", job.Id, dep)
+			}
+			graph._waiting[job.Id]++
+			graph._dependents[dep] = append(graph._dependents[dep], job.Id)
+		}
+	}
+	if cycle := graph.cycle(); len(cycle) > 0 {
+		return "", fmt.Errorf("job graph has a cycle between: %s", strings.Join(cycle, ", "))
+	}
+
+	id := uuid.NewString()
+	ctx, cancel := context.WithCancel(context.Background())
+	graph._entry = &jobEntry{_job: &Job{Id: id}, _cancel: cancel}
+	if err := service.register(graph._entry, false); err != nil {
+		cancel()
+		return "", err
+	}
+
+	go func() {
+		<-ctx.Done()
+		graph.halt(context.Canceled)
+	}()
+	ready := []*Job{}
+	for _, job := range jobs {
+		if graph._waiting[job.Id] == 0 {
+			ready = append(ready, job)
+		}
+	}
+	if len(jobs) == 0 {
+		graph.complete()
+	}
+	graph.launch(ready)
+	return id, nil
+}
+
+// cycle returns the ids that can never be started because they are part of,
+// or depend on, a dependency cycle.
+func (graph *jobGraph) cycle() []string {
+	waiting := make(map[string]int)
+	queue := []string{}
+	for id := range graph._jobs {
+		waiting[id] = graph._waiting[id]
+		if waiting[id] == 0 {
+			queue = append(queue, id)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, dependent := range graph._dependents[id] {
+			waiting[dependent]--
+			if waiting[dependent] == 0 {
+				queue = append(queue, dependent)
+			}
+		}
+	}
+	result := []string{}
+	for id := range waiting {
+		if waiting[id] > 0 {
+			result = append(result, id)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// launch starts the given jobs, holding back those exceeding the
+// concurrency cap until running ones finish.
+func (graph *jobGraph) launch(jobs []*Job) {
+	graph._lock.Lock()
+	graph._ready = append(graph._ready, jobs...)
+	batch := []*Job{}
+	for len(graph._ready) > 0 && (graph._options.MaxConcurrency <= 0 || len(graph._running) < graph._options.MaxConcurrency) {
+		job := graph._ready[0]
+		graph._ready = graph._ready[1:]
+		if _, skipped := graph._errs[job.Id]; skipped {
+			continue
+		}
+		graph._running[job.Id] = true
+		batch = append(batch, job)
+	}
+	graph._lock.Unlock()
+
+	for _, job := range batch {
+		graph._lock.Lock()
+		upstream := make(map[string]any)
+		for _, dep := range job.DependsOn {
+			upstream[dep] = graph._results[dep]
+		}
+		graph._lock.Unlock()
+
+		// The graph tracks the job by its own id, which differs from jobId
+		// when the job got attached to an existing one with the same key.
+		id := job.Id
+		wrapped := *job
+		callback := job.Callback
+		wrapped.Callback = func(jobId string, result any, err error) {
+			if callback != nil {
+				callback(jobId, result, err)
+			}
+			graph.done(id, result, err)
+		}
+		if err := graph._service.start(&wrapped, upstream, true); err != nil {
+			graph.done(job.Id, nil, err)
+		}
+	}
+}
+
+func (graph *jobGraph) done(id string, result any, err error) {
+	graph._lock.Lock()
+	delete(graph._running, id)
+	if err != nil {
+		graph._errs[id] = err
+	} else {
+		graph._results[id] = result
+	}
+	ready := []*Job{}
+	stop := []string{}
+	if err != nil && graph._options.Policy == JOB_GRAPH_FAIL_FAST && !graph._halted {
+		graph._halted = true
+		graph.skipPending(fmt.Errorf("%w: job '%s' failed", ErrJobSkipped, id))
+		for running := range graph._running {
+			stop = append(stop, running)
+		}
+	} else if err != nil {
+		graph.skipDependents(id)
+	} else if !graph._halted {
+		for _, dependent := range graph._dependents[id] {
+			graph._waiting[dependent]--
+			if _, skipped := graph._errs[dependent]; !skipped && graph._waiting[dependent] == 0 {
+				ready = append(ready, graph._jobs[dependent])
+			}
+		}
+	}
+	finished := len(graph._results)+len(graph._errs) == len(graph._jobs)
+	graph._lock.Unlock()
+
+	for _, running := range stop {
+		graph._service.Stop(running)
+	}
+	if finished {
+		graph.complete()
+		return
+	}
+	graph.launch(ready)
+}
+
+// skipDependents marks every job downstream of a failed one as skipped.
+// Must hold the lock.
+func (graph *jobGraph) skipDependents(id string) {
+	for _, dependent := range graph._dependents[id] {
+		if _, ok := graph._errs[dependent]; ok {
+			continue
+		}
+		graph._errs[dependent] = fmt.Errorf("%w: dependency '%s' failed", ErrJobSkipped, id)
+		graph.skipDependents(dependent)
+	}
+}
+
+// skipPending marks every job that has not started yet as skipped.
+// Must hold the lock.
+func (graph *jobGraph) skipPending(err error) {
+	for id := range graph._jobs {
+		_, hasResult := graph._results[id]
+		_, hasErr := graph._errs[id]
+		if !hasResult && !hasErr && !graph._running[id] {
+			graph._errs[id] = err
+		}
+	}
+}
+
+func (graph *jobGraph) halt(err error) {
+	graph._lock.Lock()
+	if graph._halted {
+		graph._lock.Unlock()
+		return
+	}
+	graph._halted = true
+	graph.skipPending(fmt.Errorf("%w: %v", ErrJobSkipped, err))
+	stop := []string{}
+	for running := range graph._running {
+		stop = append(stop, running)
+	}
+	finished := len(graph._results)+len(graph._errs) == len(graph._jobs)
+	graph._lock.Unlock()
+
+	for _, running := range stop {
+		graph._service.Stop(running)
+	}
+	if finished {
+		graph.complete()
+	}
+}
+
+func (graph *jobGraph) complete() {
+	graph._lock.Lock()
+	if graph._entry == nil {
+		graph._lock.Unlock()
+		return
+	}
+	entry := graph._entry
+	graph._entry = nil
+	graph._halted = true
+	var err error
+	if len(graph._errs) > 0 {
+		err = fmt.Errorf("%d of %d jobs failed", len(graph._errs), len(graph._jobs))
+	}
+	graph._lock.Unlock()
+
+	if graph._options.Callback != nil {
+		graph._options.Callback(graph._results, graph._errs)
+	}
+	entry._cancel()
+	graph._service.finish(entry, err)
+	graph._service.release(entry)
+}
+
+type JobBatchOptions struct {
+	MaxConcurrency int
+}
+
+// StartBatch runs independent jobs as one unit and calls onDone once all of
+// them finish. The batch id reports JOB_STATUS_FAILED if any job failed.
+func (service *DefaultJobService) StartBatch(jobs []*Job, onDone JobGraphCallback, options ...JobBatchOptions) (string, error) {
+	graphOptions := JobGraphOptions{
+		Policy:   JOB_GRAPH_CONTINUE_ON_ERROR,
+		Callback: onDone,
+	}
+	if len(options) > 0 {
+		graphOptions.MaxConcurrency = options[0].MaxConcurrency
+	}
+	return service.StartGraph(jobs, graphOptions)
+}
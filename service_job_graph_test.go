@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type graphRecorder struct {
+	_lock   sync.Mutex
+	order   []string
+	results map[string]any
+	errs    map[string]error
+}
+
+func (recorder *graphRecorder) job(id string, fail bool, deps ...string) *Job {
+	job := NewContextJob(func(ctx *JobContext) (result any, err error) {
+		recorder._lock.Lock()
+		recorder.order = append(recorder.order, id)
+		recorder._lock.Unlock()
+		if fail {
+			return nil, errors.New("failed " + id)
+		}
+		sum := 1
+		for _, val := range ctx.Upstream {
+			sum += val.(int)
+		}
+		return sum, nil
+	}, nil)
+	job.Id = id
+	job.DependsOn = deps
+	return job
+}
+
+func (recorder *graphRecorder) callback(results map[string]any, errs map[string]error) {
+	recorder.results = results
+	recorder.errs = errs
+}
+
+func TestJobGraphRunsInTopologicalOrder(t *testing.T) {
+	service := GetJobService()
+	recorder := &graphRecorder{}
+	id, err := service.StartGraph([]*Job{
+		recorder.job("load", false, "transform_a", "transform_b"),
+		recorder.job("extract", false),
+		recorder.job("transform_a", false, "extract"),
+		recorder.job("transform_b", false, "extract"),
+	}, JobGraphOptions{Callback: recorder.callback})
+	assert.Nil(t, err)
+	service.Wait(id)
+
+	assert.Equal(t, JOB_STATUS_COMPLETE, service.Status(id))
+	assert.Equal(t, "extract", recorder.order[0])
+	assert.Equal(t, "load", recorder.order[3])
+	assert.Empty(t, recorder.errs)
+	assert.Equal(t, 2, recorder.results["transform_a"])
+	assert.Equal(t, 5, recorder.results["load"])
+}
+
+func TestJobGraphContinueOnError(t *testing.T) {
+	service := GetJobService()
+	recorder := &graphRecorder{}
+	id, err := service.StartGraph([]*Job{
+		recorder.job("a", true),
+		recorder.job("b", false, "a"),
+		recorder.job("c", false, "b"),
+		recorder.job("d", false),
+	}, JobGraphOptions{Policy: JOB_GRAPH_CONTINUE_ON_ERROR, Callback: recorder.callback})
+	assert.Nil(t, err)
+	service.Wait(id)
+
+	assert.Equal(t, "failed a", recorder.errs["a"].Error())
+	assert.True(t, errors.Is(recorder.errs["b"], ErrJobSkipped))
+	assert.True(t, errors.Is(recorder.errs["c"], ErrJobSkipped))
+	assert.Equal(t, 1, recorder.results["d"])
+}
+
+func TestJobGraphFailFast(t *testing.T) {
+	service := GetJobService()
+	recorder := &graphRecorder{}
+	id, err := service.StartGraph([]*Job{
+		recorder.job("a", true),
+		recorder.job("b", false, "a"),
+		recorder.job("c", false, "a"),
+	}, JobGraphOptions{Callback: recorder.callback})
+	assert.Nil(t, err)
+	service.Wait(id)
+
+	assert.Equal(t, []string{"a"}, recorder.order)
+	assert.Len(t, recorder.errs, 3)
+	assert.Empty(t, recorder.results)
+}
+
+func TestJobGraphValidation(t *testing.T) {
+	service := GetJobService()
+	recorder := &graphRecorder{}
+
+	_, err := service.StartGraph([]*Job{
+		recorder.job("a", false, "c"),
+		recorder.job("b", false, "a"),
+		recorder.job("c", false, "b"),
+		recorder.job("d", false),
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "a, b, c")
+
+	_, err = service.StartGraph([]*Job{recorder.job("a", false, "missing")})
+	assert.NotNil(t, err)
+	assert.Empty(t, recorder.order)
+}
+
+func TestEmptyJobGraph(t *testing.T) {
+	service := GetJobService()
+	called := false
+	id, err := service.StartGraph(nil, JobGraphOptions{
+		Callback: func(results map[string]any, errs map[string]error) { called = true },
+	})
+	assert.Nil(t, err)
+	service.Wait(id)
+	assert.True(t, called)
+}
+
+func TestStartBatch(t *testing.T) {
+	service := GetJobService()
+	recorder := &graphRecorder{}
+	id, err := service.StartBatch([]*Job{
+		recorder.job("a", false),
+		recorder.job("b", true),
+		recorder.job("c", false),
+	}, recorder.callback)
+	assert.Nil(t, err)
+	service.Wait(id)
+
+	assert.Len(t, recorder.order, 3)
+	assert.Equal(t, map[string]any{"a": 1, "c": 1}, recorder.results)
+	assert.Equal(t, "failed b", recorder.errs["b"].Error())
+	assert.Equal(t, JOB_STATUS_FAILED, service.Status(id))
+}
+
+func TestStartBatchWithConcurrencyCap(t *testing.T) {
+	service := GetJobService()
+	var lock sync.Mutex
+	running, peak := 0, 0
+	jobs := []*Job{}
+	for i := 0; i < 6; i++ {
+		jobs = append(jobs, NewJob(func() (result any, err error) {
+			lock.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			lock.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			lock.Lock()
+			running--
+			lock.Unlock()
+			return nil, nil
+		}, nil))
+	}
+	results := 0
+	id, err := service.StartBatch(jobs, func(res map[string]any, errs map[string]error) {
+		results = len(res)
+	}, JobBatchOptions{MaxConcurrency: 2})
+	assert.Nil(t, err)
+	service.Wait(id)
+
+	assert.Equal(t, 6, results)
+	assert.LessOrEqual(t, peak, 2)
+	assert.Equal(t, JOB_STATUS_COMPLETE, service.Status(id))
+}
+
+func TestJobGraphWithAttachedJob(t *testing.T) {
+	service := GetJobService(JobServiceOptions{DedupPolicy: JOB_DEDUP_ATTACH})
+	release := make(chan bool)
+	running := keyedJob("report:1", release, nil)
+	assert.Nil(t, service.Start(running))
+
+	recorder := &graphRecorder{}
+	report := keyedJob("report:1", nil, nil)
+	report.Id = "report"
+	mail := NewContextJob(func(ctx *JobContext) (result any, err error) {
+		return ctx.Upstream["report"], nil
+	}, nil)
+	mail.Id = "mail"
+	mail.DependsOn = []string{"report"}
+	id, err := service.StartGraph([]*Job{report, mail}, JobGraphOptions{Callback: recorder.callback})
+	assert.Nil(t, err)
+	release <- true
+	service.Wait(id)
+
+	assert.Equal(t, JOB_STATUS_COMPLETE, service.Status(id))
+	assert.Equal(t, "report", recorder.results["report"])
+	assert.Equal(t, "report", recorder.results["mail"])
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	JOB_EVENT_ENQUEUED = iota
+	JOB_EVENT_STARTED
+	JOB_EVENT_SUCCEEDED
+	JOB_EVENT_FAILED
+	JOB_EVENT_CANCELLED
+	JOB_EVENT_RETRIED
+)
+
+// JobEvent describes a lifecycle change of a job. Attempts counts how many
+// times the action has run, so it is 0 for jobs cancelled before starting.
+// JOB_EVENT_RETRIED is emitted when Consume starts a job whose message the
+// broker delivers again, with Attempts set to the earlier deliveries.
+type JobEvent struct {
+	Type     int
+	Job      *Job
+	Result   any
+	Err      error
+	Attempts int
+	Time     time.Time
+	Duration time.Duration
+}
+
+type JobHook = func(event JobEvent)
+
+// JobMiddleware wraps the action of every job run by the service. The first
+// registered middleware is the outermost one.
+type JobMiddleware = func(job *Job, next JobContextAction) JobContextAction
+
+func (service *DefaultJobService) Use(middleware ...JobMiddleware) {
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	service._middleware = append(service._middleware, middleware...)
+}
+
+func (service *DefaultJobService) AddHook(hook JobHook) {
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	service._hooks = append(service._hooks, hook)
+}
+
+func (service *DefaultJobService) wrap(job *Job, action JobContextAction) JobContextAction {
+	service._lock.Lock()
+	middleware := service._middleware
+	service._lock.Unlock()
+	for i := len(middleware) - 1; i >= 0; i-- {
+		action = middleware[i](job, action)
+	}
+	return action
+}
+
+func (service *DefaultJobService) emit(event JobEvent) {
+	service._lock.Lock()
+	hooks := service._hooks
+	service._lock.Unlock()
+	if event.Time.IsZero() {
+		event.Time = service._clock.Now()
+	}
+	for _, hook := range hooks {
+		func() {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					service.recovered(event.Job.Id, recovered)
+				}
+			}()
+			hook(event)
+		}()
+	}
+}
+
+func doneEventType(ctx context.Context, err error) int {
+	if ctx.Err() != nil {
+		return JOB_EVENT_CANCELLED
+	} else if err != nil {
+		return JOB_EVENT_FAILED
+	}
+	return JOB_EVENT_SUCCEEDED
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type eventRecorder struct {
+	_lock  sync.Mutex
+	events []int
+}
+
+func (recorder *eventRecorder) hook(event JobEvent) {
+	recorder._lock.Lock()
+	defer recorder._lock.Unlock()
+	recorder.events = append(recorder.events, event.Type)
+}
+
+func TestJobMiddlewareOrder(t *testing.T) {
+	service := GetJobService()
+	calls := []string{}
+	tag := func(name string) JobMiddleware {
+		return func(job *Job, next JobContextAction) JobContextAction {
+			return func(ctx *JobContext) (result any, err error) {
+				calls = append(calls, name+":before")
+				result, err = next(ctx)
+				calls = append(calls, name+":after")
+				return result, err
+			}
+		}
+	}
+	service.Use(tag("outer"), tag("inner"))
+
+	job := NewJob(func() (result any, err error) {
+		calls = append(calls, "action")
+		return nil, nil
+	}, nil)
+	assert.Nil(t, service.Start(job))
+	service.Wait(job.Id)
+
+	assert.Equal(t, []string{"outer:before", "inner:before", "action", "inner:after", "outer:after"}, calls)
+}
+
+func TestJobMiddlewareCanReplaceResult(t *testing.T) {
+	service := GetJobService()
+	service.Use(func(job *Job, next JobContextAction) JobContextAction {
+		return func(ctx *JobContext) (result any, err error) {
+			return nil, errors.New("unauthorized")
+		}
+	})
+	var callbackErr error
+	job := NewJob(func() (result any, err error) {
+		return 1, nil
+	}, func(jobId string, result any, err error) {
+		callbackErr = err
+	})
+	assert.Nil(t, service.Start(job))
+	service.Wait(job.Id)
+	assert.Equal(t, "unauthorized", callbackErr.Error())
+}
+
+func TestJobLifecycleHooks(t *testing.T) {
+	service := GetJobService()
+	recorder := &eventRecorder{}
+	service.AddHook(recorder.hook)
+
+	ok := NewJob(func() (result any, err error) { return 1, nil }, nil)
+	assert.Nil(t, service.Start(ok))
+	service.Wait(ok.Id)
+	failed := NewJob(func() (result any, err error) { return nil, errors.New("failed") }, nil)
+	assert.Nil(t, service.Start(failed))
+	service.Wait(failed.Id)
+
+	assert.Equal(t, []int{
+		JOB_EVENT_ENQUEUED, JOB_EVENT_STARTED, JOB_EVENT_SUCCEEDED,
+		JOB_EVENT_ENQUEUED, JOB_EVENT_STARTED, JOB_EVENT_FAILED,
+	}, recorder.events)
+}
+
+func TestJobCancelledHook(t *testing.T) {
+	service := GetJobService()
+	recorder := &eventRecorder{}
+	done := make(chan bool)
+	service.AddHook(func(event JobEvent) {
+		recorder.hook(event)
+		if event.Type == JOB_EVENT_CANCELLED {
+			done <- true
+		}
+	})
+	started := make(chan bool)
+	job := NewContextJob(func(ctx *JobContext) (result any, err error) {
+		started <- true
+		<-ctx.Done()
+		return nil, nil
+	}, nil)
+	assert.Nil(t, service.Start(job))
+	<-started
+	service.Stop(job.Id)
+	<-done
+
+	assert.Equal(t, []int{JOB_EVENT_ENQUEUED, JOB_EVENT_STARTED, JOB_EVENT_CANCELLED}, recorder.events)
+}
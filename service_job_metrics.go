@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var DefaultJobDurationBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
+// JobMetrics collects job counters from a JobService's lifecycle hooks and
+// serves them in the Prometheus text exposition format.
+type JobMetrics struct {
+	_lock      sync.Mutex
+	_service   JobService
+	_buckets   []float64
+	_counters  map[string]map[string]float64
+	_running   map[string]float64
+	_durations map[string]*jobHistogram
+}
+
+type jobHistogram struct {
+	_counts []uint64
+	_count  uint64
+	_sum    float64
+}
+
+var jobCounterNames = map[int]string{
+	JOB_EVENT_ENQUEUED:  "jobs_enqueued_total",
+	JOB_EVENT_STARTED:   "jobs_started_total",
+	JOB_EVENT_SUCCEEDED: "jobs_succeeded_total",
+	JOB_EVENT_FAILED:    "jobs_failed_total",
+	JOB_EVENT_CANCELLED: "jobs_cancelled_total",
+	JOB_EVENT_RETRIED:   "jobs_retries_total",
+}
+
+var jobCounterHelp = map[string]string{
+	"jobs_enqueued_total":  "Number of jobs submitted.",
+	"jobs_started_total":   "Number of jobs started.",
+	"jobs_succeeded_total": "Number of jobs that completed without error.",
+	"jobs_failed_total":    "Number of jobs that completed with an error.",
+	"jobs_cancelled_total": "Number of jobs cancelled before completing.",
+	"jobs_retries_total":   "Number of jobs run again after the broker redelivered them.",
+}
+
+func NewJobMetrics(service JobService, buckets ...float64) *JobMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultJobDurationBuckets
+	}
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	metrics := &JobMetrics{
+		_service:   service,
+		_buckets:   sorted,
+		_counters:  make(map[string]map[string]float64),
+		_running:   make(map[string]float64),
+		_durations: make(map[string]*jobHistogram),
+	}
+	for _, name := range jobCounterNames {
+		metrics._counters[name] = make(map[string]float64)
+	}
+	service.AddHook(metrics.observe)
+	return metrics
+}
+
+func (metrics *JobMetrics) observe(event JobEvent) {
+	metrics._lock.Lock()
+	defer metrics._lock.Unlock()
+	group := event.Job.Group
+	if name, ok := jobCounterNames[event.Type]; ok {
+		metrics._counters[name][group]++
+	}
+	switch event.Type {
+	case JOB_EVENT_STARTED:
+		metrics._running[group]++
+	case JOB_EVENT_SUCCEEDED, JOB_EVENT_FAILED, JOB_EVENT_CANCELLED:
+		if event.Attempts == 0 {
+			return
+		}
+		metrics._running[group]--
+		histogram, ok := metrics._durations[group]
+		if !ok {
+			histogram = &jobHistogram{_counts: make([]uint64, len(metrics._buckets))}
+			metrics._durations[group] = histogram
+		}
+		seconds := event.Duration.Seconds()
+		for i, bound := range metrics._buckets {
+			if seconds <= bound {
+				histogram._counts[i]++
+			}
+		}
+		histogram._count++
+		histogram._sum += seconds
+	}
+}
+
+func (metrics *JobMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WriteTo(w)
+}
+
+func (metrics *JobMetrics) WriteTo(w io.Writer) (int64, error) {
+	var out strings.Builder
+	metrics._lock.Lock()
+	names := make([]string, 0, len(metrics._counters))
+	for name := range metrics._counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s counter\n", name, jobCounterHelp[name], name)
+		values := metrics._counters[name]
+		for _, group := range sortedMetricKeys(values) {
+			fmt.Fprintf(&out, "%s{group=\"%s\"} %s\n", name, escapeMetricLabel(group), formatMetricValue(values[group]))
+		}
+	}
+
+	out.WriteString("# HELP jobs_running Number of jobs currently running.\n# TYPE jobs_running gauge\n")
+	for _, group := range sortedMetricKeys(metrics._running) {
+		fmt.Fprintf(&out, "jobs_running{group=\"%s\"} %s\n", escapeMetricLabel(group), formatMetricValue(metrics._running[group]))
+	}
+
+	out.WriteString("# HELP job_duration_seconds Time spent running jobs.\n# TYPE job_duration_seconds histogram\n")
+	groups := make([]string, 0, len(metrics._durations))
+	for group := range metrics._durations {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		histogram := metrics._durations[group]
+		label := escapeMetricLabel(group)
+		for i, bound := range metrics._buckets {
+			fmt.Fprintf(&out, "job_duration_seconds_bucket{group=\"%s\",le=\"%s\"} %d\n", label, formatMetricValue(bound), histogram._counts[i])
+		}
+		fmt.Fprintf(&out, "job_duration_seconds_bucket{group=\"%s\",le=\"+Inf\"} %d\n", label, histogram._count)
+		fmt.Fprintf(&out, "job_duration_seconds_sum{group=\"%s\"} %s\n", label, formatMetricValue(histogram._sum))
+		fmt.Fprintf(&out, "job_duration_seconds_count{group=\"%s\"} %d\n", label, histogram._count)
+	}
+	metrics._lock.Unlock()
+
+	fmt.Fprintf(&out, "# HELP jobs_queue_depth Number of jobs waiting for a worker.\n# TYPE jobs_queue_depth gauge\njobs_queue_depth %d\n",
+		metrics._service.QueueLength())
+	n, err := io.WriteString(w, out.String())
+	return int64(n), err
+}
+
+func sortedMetricKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func escapeMetricLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+func formatMetricValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobMetricsExport(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	service := GetJobService(JobServiceOptions{Clock: clock})
+	metrics := NewJobMetrics(service, 1, 10)
+
+	ok := NewJob(func() (result any, err error) { return nil, nil }, nil)
+	ok.Group = "reports"
+	assert.Nil(t, service.Start(ok))
+	service.Wait(ok.Id)
+
+	failing := NewJob(func() (result any, err error) { return nil, errors.New("always failing") }, nil)
+	assert.Nil(t, service.Start(failing))
+	service.Wait(failing.Id)
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+
+	assert.Contains(t, recorder.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, body, "# TYPE jobs_started_total counter\n")
+	assert.Contains(t, body, "jobs_started_total{group=\"reports\"} 1\n")
+	assert.Contains(t, body, "jobs_succeeded_total{group=\"reports\"} 1\n")
+	assert.Contains(t, body, "jobs_failed_total{group=\"\"} 1\n")
+	assert.Contains(t, body, "jobs_running{group=\"reports\"} 0\n")
+	assert.Contains(t, body, "job_duration_seconds_bucket{group=\"reports\",le=\"1\"} 1\n")
+	assert.Contains(t, body, "job_duration_seconds_bucket{group=\"reports\",le=\"+Inf\"} 1\n")
+	assert.Contains(t, body, "job_duration_seconds_count{group=\"\"} 1\n")
+	assert.Contains(t, body, "jobs_queue_depth 0\n")
+}
+
+func TestJobMetricsCountsBrokerRedeliveries(t *testing.T) {
+	broker := NewMemoryJobBroker()
+	service := GetJobService(JobServiceOptions{Broker: broker})
+	metrics := NewJobMetrics(service)
+	done := make(chan bool, 1)
+	attempts := 0
+	service.RegisterHandler("flaky", func(payload []byte) (result any, err error) {
+		attempts++
+		if attempts < 3 {
+			return nil, errors.New("try again")
+		}
+		done <- true
+		return nil, nil
+	})
+	job, _ := NewHandlerJob("flaky", nil, nil)
+	assert.Nil(t, service.Start(job))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	consumed := make(chan error)
+	go func() {
+		consumed <- service.Consume(ctx, JobConsumerOptions{PollInterval: time.Millisecond})
+	}()
+	<-done
+	cancel()
+	<-consumed
+
+	var out strings.Builder
+	metrics.WriteTo(&out)
+	assert.Contains(t, out.String(), "jobs_retries_total{group=\"\"} 2\n")
+}
+
+func TestJobMetricsLabelEscaping(t *testing.T) {
+	assert.Equal(t, `a\"b\\c\nd`, escapeMetricLabel("a\"b\\c\nd"))
+}
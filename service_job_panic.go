@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+type JobPanicHook = func(err *JobPanicError)
+
+type JobPanicError struct {
+	JobId string
+	Value any
+	Stack []byte
+}
+
+func (err *JobPanicError) Error() string {
+	return fmt.Sprintf("job '%s' panicked: %v\n%s", err.JobId, err.Value, err.Stack)
+}
+
+func IsJobPanicError(err error) bool {
+	_, ok := err.(*JobPanicError)
+	return ok
+}
+
+func (service *DefaultJobService) run(job *Job, action JobContextAction, ctx *JobContext) (result any, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result = nil
+			err = service.recovered(job.Id, recovered)
+		}
+	}()
+	return action(ctx)
+}
+
+func (service *DefaultJobService) notify(job *Job, result any, err error) {
+	if job.Callback == nil {
+		return
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			service.recovered(job.Id, recovered)
+		}
+	}()
+	job.Callback(job.Id, result, err)
+}
+
+func (service *DefaultJobService) recovered(jobId string, value any) *JobPanicError {
+	err := &JobPanicError{
+		JobId: jobId,
+		Value: value,
+		Stack: debug.Stack(),
+	}
+	if service._onPanic != nil {
+		func() {
+			defer func() { recover() }()
+			service._onPanic(err)
+		}()
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobPanicIsRecovered(t *testing.T) {
+	var hooked *JobPanicError
+	service := GetJobService(JobServiceOptions{
+		OnPanic: func(err *JobPanicError) { hooked = err },
+	})
+	var callbackErr error
+	job := NewJob(func() (result any, err error) {
+		panic("boom")
+	}, func(jobId string, result any, err error) {
+		callbackErr = err
+	})
+
+	assert.Nil(t, service.Start(job))
+	service.Wait(job.Id)
+
+	assert.True(t, IsJobPanicError(callbackErr))
+	panicErr := callbackErr.(*JobPanicError)
+	assert.Equal(t, job.Id, panicErr.JobId)
+	assert.Equal(t, "boom", panicErr.Value)
+	assert.Contains(t, string(panicErr.Stack), "service_job_panic_test.go")
+	assert.Equal(t, panicErr, hooked)
+	assert.Equal(t, JOB_STATUS_FAILED, service.Status(job.Id))
+}
+
+func TestJobCallbackPanicIsRecovered(t *testing.T) {
+	hooked := 0
+	service := GetJobService(JobServiceOptions{
+		OnPanic: func(err *JobPanicError) { hooked++ },
+	})
+	job := NewJob(func() (result any, err error) {
+		return 1, nil
+	}, func(jobId string, result any, err error) {
+		panic(errors.New("callback failed"))
+	})
+
+	assert.Nil(t, service.Start(job))
+	service.Wait(job.Id)
+
+	assert.Equal(t, 1, hooked)
+	assert.Equal(t, JOB_STATUS_COMPLETE, service.Status(job.Id))
+}
+
+func TestFailedJobStatus(t *testing.T) {
+	service := GetJobService()
+	job := NewJob(func() (result any, err error) {
+		return nil, errors.New("failed")
+	}, nil)
+
+	assert.Nil(t, service.Start(job))
+	service.Wait(job.Id)
+	assert.Equal(t, JOB_STATUS_FAILED, service.Status(job.Id))
+}
+
+func TestFailedJobStatusExpires(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	service := GetJobService(JobServiceOptions{Clock: clock})
+	failing := func() *Job {
+		return NewJob(func() (result any, err error) { return nil, errors.New("failed") }, nil)
+	}
+	first := failing()
+	assert.Nil(t, service.Start(first))
+	service.Wait(first.Id)
+
+	clock.Advance(jobFailedRetention)
+	assert.Equal(t, JOB_STATUS_COMPLETE, service.Status(first.Id))
+	second := failing()
+	assert.Nil(t, service.Start(second))
+	service.Wait(second.Id)
+
+	assert.Equal(t, JOB_STATUS_FAILED, service.Status(second.Id))
+	assert.Len(t, service.(*DefaultJobService)._failed, 1)
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+type JobProgress struct {
+	JobId   string
+	Percent float64
+	Message string
+	Metrics map[string]float64
+	Time    time.Time
+}
+
+// JobContext is handed to context actions. It is cancelled when the job is
+// stopped and lets the action report progress to subscribers. Jobs run as
+// part of a graph find the results of their dependencies in Upstream.
+type JobContext struct {
+	context.Context
+	JobId    string
+	Upstream map[string]any
+	_report  func(progress JobProgress)
+	_clock   Clock
+}
+
+func (ctx *JobContext) Report(percent float64, message string, metrics ...map[string]float64) {
+	if ctx._report == nil {
+		return
+	}
+	progress := JobProgress{
+		JobId:   ctx.JobId,
+		Percent: percent,
+		Message: message,
+		Time:    ctx._clock.Now(),
+	}
+	if len(metrics) > 0 {
+		progress.Metrics = metrics[0]
+	}
+	ctx._report(progress)
+}
+
+func (service *DefaultJobService) Progress(id string) (JobProgress, bool) {
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	entry, ok := service._jobs[id]
+	if !ok || entry._progress == nil {
+		return JobProgress{}, false
+	}
+	return *entry._progress, true
+}
+
+// Subscribe streams progress events of a running job. The channel is closed
+// when the job finishes or the returned unsubscribe function is called.
+// Slow readers lose the oldest events rather than blocking the job.
+func (service *DefaultJobService) Subscribe(id string) (<-chan JobProgress, func()) {
+	ch := make(chan JobProgress, jobProgressBuffer)
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	entry, ok := service._jobs[id]
+	if !ok {
+		close(ch)
+		return ch, func() {}
+	}
+	if entry._progress != nil {
+		ch <- *entry._progress
+	}
+	entry._subscribers = append(entry._subscribers, ch)
+	return ch, func() {
+		service._lock.Lock()
+		defer service._lock.Unlock()
+		for i, subscriber := range entry._subscribers {
+			if subscriber == ch {
+				entry._subscribers = append(entry._subscribers[:i], entry._subscribers[i+1:]...)
+				close(ch)
+				return
+			}
+		}
+	}
+}
+
+func (service *DefaultJobService) publish(entry *jobEntry, progress JobProgress) {
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	entry._progress = &progress
+	for _, subscriber := range entry._subscribers {
+		select {
+		case subscriber <- progress:
+		default:
+			select {
+			case <-subscriber:
+			default:
+			}
+			subscriber <- progress
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobProgressSubscription(t *testing.T) {
+	service := GetJobService()
+	release := make(chan bool)
+	job := NewContextJob(func(ctx *JobContext) (result any, err error) {
+		<-release
+		ctx.Report(50, "half way")
+		ctx.Report(100, "done", map[string]float64{"rows": 20})
+		return nil, nil
+	}, nil)
+	assert.Nil(t, service.Start(job))
+
+	events, _ := service.Subscribe(job.Id)
+	release <- true
+	received := []JobProgress{}
+	for progress := range events {
+		received = append(received, progress)
+	}
+
+	assert.Len(t, received, 2)
+	assert.Equal(t, float64(50), received[0].Percent)
+	assert.Equal(t, "half way", received[0].Message)
+	assert.Equal(t, job.Id, received[1].JobId)
+	assert.Equal(t, float64(20), received[1].Metrics["rows"])
+}
+
+func TestJobProgressLatest(t *testing.T) {
+	service := GetJobService()
+	reported := make(chan bool)
+	release := make(chan bool)
+	job := NewContextJob(func(ctx *JobContext) (result any, err error) {
+		ctx.Report(10, "started")
+		reported <- true
+		<-release
+		return nil, nil
+	}, nil)
+	assert.Nil(t, service.Start(job))
+	<-reported
+
+	progress, ok := service.Progress(job.Id)
+	assert.True(t, ok)
+	assert.Equal(t, "started", progress.Message)
+
+	events, unsubscribe := service.Subscribe(job.Id)
+	assert.Equal(t, "started", (<-events).Message)
+	unsubscribe()
+	_, open := <-events
+	assert.False(t, open)
+
+	release <- true
+	service.Wait(job.Id)
+	_, ok = service.Progress(job.Id)
+	assert.False(t, ok)
+}
+
+func TestSubscribeToUnknownJob(t *testing.T) {
+	events, _ := GetJobService().Subscribe("missing")
+	_, open := <-events
+	assert.False(t, open)
+}
+
+func TestStopCancelsJobContext(t *testing.T) {
+	service := GetJobService()
+	started := make(chan bool)
+	causes := make(chan error, 1)
+	job := NewContextJob(func(ctx *JobContext) (result any, err error) {
+		started <- true
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, func(jobId string, result any, err error) {
+		causes <- err
+	})
+	assert.Nil(t, service.Start(job))
+	<-started
+	service.Stop(job.Id)
+
+	assert.Equal(t, JOB_STATUS_COMPLETE, service.Status(job.Id))
+	assert.Equal(t, context.Canceled, <-causes)
+}
+
+func TestJobProgressUsesServiceClock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	service := GetJobService(JobServiceOptions{Clock: clock})
+	release := make(chan bool)
+	job := NewContextJob(func(ctx *JobContext) (result any, err error) {
+		<-release
+		ctx.Report(100, "done")
+		return nil, nil
+	}, nil)
+	assert.Nil(t, service.Start(job))
+
+	events, _ := service.Subscribe(job.Id)
+	release <- true
+	assert.Equal(t, clock.Now(), (<-events).Time)
+}
@@ -0,0 +1,89 @@
+package utils
+
+func (service *DefaultJobService) QueueLength() int {
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	return len(service._queue)
+}
+
+// enqueue runs the entry right away when a worker is free, otherwise parks
+// it in the priority queue.
+func (service *DefaultJobService) enqueue(entry *jobEntry) {
+	service._lock.Lock()
+	if service._maxWorkers > 0 && service._working >= service._maxWorkers {
+		entry._queued = true
+		entry._queuedAt = service._clock.Now()
+		service._queue = append(service._queue, entry)
+		service._lock.Unlock()
+		return
+	}
+	service._working++
+	entry._counted = true
+	service._lock.Unlock()
+	go entry._run()
+}
+
+// unqueue takes a cancelled entry out of the queue, or off its timer, and
+// lets it finish without waiting for a free worker.
+func (service *DefaultJobService) unqueue(entry *jobEntry) {
+	service._lock.Lock()
+	found := false
+	if entry._scheduled || entry._throttled {
+		if entry._throttled {
+			for _, bucket := range entry._buckets {
+				bucket.refund()
+			}
+		}
+		entry._scheduled = false
+		entry._throttled = false
+		if entry._timer != nil {
+			entry._timer.Stop()
+		}
+		found = true
+	}
+	for i := range service._queue {
+		if service._queue[i] == entry {
+			service._queue = append(service._queue[:i], service._queue[i+1:]...)
+			entry._queued = false
+			found = true
+			break
+		}
+	}
+	service._lock.Unlock()
+	if found {
+		go entry._run()
+	}
+}
+
+// dispatch hands the worker freed by a finished entry to the queued entry
+// with the highest aged priority. Ties go to the one queued first.
+func (service *DefaultJobService) dispatch(finished *jobEntry) {
+	service._lock.Lock()
+	if !finished._counted {
+		service._lock.Unlock()
+		return
+	}
+	if len(service._queue) == 0 {
+		service._working--
+		service._lock.Unlock()
+		return
+	}
+	now := service._clock.Now()
+	best := 0
+	bestScore := 0.0
+	for i, entry := range service._queue {
+		score := float64(entry._job.Priority)
+		if service._agingInterval > 0 {
+			score += float64(now.Sub(entry._queuedAt)) / float64(service._agingInterval)
+		}
+		if i == 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	next := service._queue[best]
+	service._queue = append(service._queue[:best], service._queue[best+1:]...)
+	next._queued = false
+	next._counted = true
+	service._lock.Unlock()
+	go next._run()
+}
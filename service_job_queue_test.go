@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type orderRecorder struct {
+	_lock sync.Mutex
+	order []string
+}
+
+func (recorder *orderRecorder) job(name string, priority int, release chan bool) *Job {
+	job := NewJob(func() (result any, err error) {
+		if release != nil {
+			<-release
+		}
+		recorder._lock.Lock()
+		recorder.order = append(recorder.order, name)
+		recorder._lock.Unlock()
+		return nil, nil
+	}, nil)
+	job.Priority = priority
+	return job
+}
+
+func TestQueuedJobsRunByPriority(t *testing.T) {
+	service := GetJobService(JobServiceOptions{MaxWorkers: 1})
+	recorder := &orderRecorder{}
+	release := make(chan bool)
+	blocker := recorder.job("blocker", 0, release)
+	assert.Nil(t, service.Start(blocker))
+
+	low := recorder.job("low", 0, nil)
+	mid := recorder.job("mid", 5, nil)
+	high := recorder.job("high", 10, nil)
+	for _, job := range []*Job{low, mid, high} {
+		assert.Nil(t, service.Start(job))
+	}
+	assert.Equal(t, JOB_STATUS_WORKING, service.Status(blocker.Id))
+	assert.Equal(t, JOB_STATUS_QUEUED, service.Status(low.Id))
+
+	release <- true
+	service.Wait(low.Id)
+	assert.Equal(t, []string{"blocker", "high", "mid", "low"}, recorder.order)
+}
+
+func TestQueuedJobsAge(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	service := GetJobService(JobServiceOptions{
+		Clock:         clock,
+		MaxWorkers:    1,
+		AgingInterval: time.Minute,
+	})
+	recorder := &orderRecorder{}
+	release := make(chan bool)
+	assert.Nil(t, service.Start(recorder.job("blocker", 0, release)))
+
+	old := recorder.job("old", 0, nil)
+	assert.Nil(t, service.Start(old))
+	clock.Advance(10 * time.Minute)
+	fresh := recorder.job("fresh", 5, nil)
+	assert.Nil(t, service.Start(fresh))
+
+	release <- true
+	service.Wait(old.Id)
+	service.Wait(fresh.Id)
+	assert.Equal(t, []string{"blocker", "old", "fresh"}, recorder.order)
+}
+
+func TestStopQueuedJob(t *testing.T) {
+	service := GetJobService(JobServiceOptions{MaxWorkers: 1})
+	recorder := &orderRecorder{}
+	release := make(chan bool)
+	blocker := recorder.job("blocker", 0, release)
+	assert.Nil(t, service.Start(blocker))
+
+	errs := make(chan error, 1)
+	queued := recorder.job("queued", 0, nil)
+	queued.Callback = func(jobId string, result any, err error) { errs <- err }
+	assert.Nil(t, service.Start(queued))
+	service.Stop(queued.Id)
+
+	assert.NotNil(t, <-errs)
+	release <- true
+	service.Wait(blocker.Id)
+	assert.Equal(t, []string{"blocker"}, recorder.order)
+}
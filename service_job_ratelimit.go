@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimit allows Rate jobs per second on average, with bursts of up to
+// Burst jobs.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type tokenBucket struct {
+	_lock   sync.Mutex
+	_clock  Clock
+	_limit  RateLimit
+	_tokens float64
+	_last   time.Time
+}
+
+func newTokenBucket(clock Clock, limit RateLimit) *tokenBucket {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &tokenBucket{
+		_clock:  clock,
+		_limit:  limit,
+		_tokens: float64(limit.Burst),
+		_last:   clock.Now(),
+	}
+}
+
+// reserve takes a token, going into debt when none is left, and returns the
+// time at which the caller may proceed.
+func (bucket *tokenBucket) reserve() time.Time {
+	bucket._lock.Lock()
+	defer bucket._lock.Unlock()
+	now := bucket._clock.Now()
+	if elapsed := now.Sub(bucket._last); elapsed > 0 {
+		bucket._tokens += elapsed.Seconds() * bucket._limit.Rate
+		if bucket._tokens > float64(bucket._limit.Burst) {
+			bucket._tokens = float64(bucket._limit.Burst)
+		}
+		bucket._last = now
+	}
+	bucket._tokens--
+	if bucket._tokens >= 0 {
+		return now
+	}
+	return now.Add(time.Duration(-bucket._tokens / bucket._limit.Rate * float64(time.Second)))
+}
+
+// refund gives back a token reserved for a job that was cancelled before
+// it could use it.
+func (bucket *tokenBucket) refund() {
+	bucket._lock.Lock()
+	defer bucket._lock.Unlock()
+	bucket._tokens++
+	if bucket._tokens > float64(bucket._limit.Burst) {
+		bucket._tokens = float64(bucket._limit.Burst)
+	}
+}
+
+// SetRateLimit limits how fast jobs of a group are started. The empty group
+// applies to every job. A non-positive rate removes the limit.
+func (service *DefaultJobService) SetRateLimit(group string, limit RateLimit) {
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	if limit.Rate <= 0 {
+		delete(service._limits, group)
+		return
+	}
+	service._limits[group] = newTokenBucket(service._clock, limit)
+}
+
+// admit reserves the job's tokens under the global and group limits and
+// enqueues it once they are due. Jobs waiting for tokens hold no worker, so
+// a slow group cannot starve other groups.
+func (service *DefaultJobService) admit(entry *jobEntry) {
+	service._lock.Lock()
+	buckets := []*tokenBucket{}
+	if bucket, ok := service._limits[""]; ok {
+		buckets = append(buckets, bucket)
+	}
+	if bucket, ok := service._limits[entry._job.Group]; ok && entry._job.Group != "" {
+		buckets = append(buckets, bucket)
+	}
+	service._lock.Unlock()
+
+	var at time.Time
+	for _, bucket := range buckets {
+		if reserved := bucket.reserve(); reserved.After(at) {
+			at = reserved
+		}
+	}
+	wait := at.Sub(service._clock.Now())
+	if at.IsZero() || wait <= 0 {
+		service.enqueue(entry)
+		return
+	}
+	service._lock.Lock()
+	defer service._lock.Unlock()
+	entry._throttled = true
+	entry._buckets = buckets
+	entry._timer = service._clock.AfterFunc(wait, func() {
+		service._lock.Lock()
+		due := entry._throttled
+		entry._throttled = false
+		service._lock.Unlock()
+		if due {
+			service.enqueue(entry)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	bucket := newTokenBucket(clock, RateLimit{Rate: 2, Burst: 2})
+	start := clock.Now()
+
+	assert.Equal(t, start, bucket.reserve())
+	assert.Equal(t, start, bucket.reserve())
+	assert.Equal(t, start.Add(500*time.Millisecond), bucket.reserve())
+	assert.Equal(t, start.Add(time.Second), bucket.reserve())
+
+	clock.Advance(10 * time.Second)
+	assert.Equal(t, clock.Now(), bucket.reserve())
+}
+
+func TestRateLimitedJobsWaitForTokens(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	service := GetJobService(JobServiceOptions{Clock: clock})
+	service.SetRateLimit("payments", RateLimit{Rate: 1, Burst: 1})
+	ran := make(chan int, 3)
+	jobs := []*Job{}
+	for i := 1; i <= 3; i++ {
+		i := i
+		job := NewJob(func() (result any, err error) {
+			ran <- i
+			return nil, nil
+		}, nil)
+		job.Group = "payments"
+		jobs = append(jobs, job)
+	}
+	other := NewJob(func() (result any, err error) { return nil, nil }, nil)
+
+	assert.Nil(t, service.Start(jobs[0]))
+	service.Wait(jobs[0].Id)
+	assert.Nil(t, service.Start(jobs[1]))
+	assert.Nil(t, service.Start(jobs[2]))
+	assert.Nil(t, service.Start(other))
+	service.Wait(other.Id)
+	assert.Equal(t, 1, <-ran)
+
+	clock.Advance(time.Second)
+	second := <-ran
+	assert.Empty(t, ran)
+
+	clock.Advance(time.Second)
+	third := <-ran
+	assert.ElementsMatch(t, []int{2, 3}, []int{second, third})
+}
+
+func TestRateLimitedJobCanBeStopped(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	service := GetJobService(JobServiceOptions{Clock: clock})
+	service.SetRateLimit("", RateLimit{Rate: 0.001, Burst: 1})
+	first := NewJob(func() (result any, err error) { return nil, nil }, nil)
+	assert.Nil(t, service.Start(first))
+	service.Wait(first.Id)
+
+	errs := make(chan error, 1)
+	job := NewJob(func() (result any, err error) {
+		return "ran", nil
+	}, func(jobId string, result any, err error) {
+		errs <- err
+	})
+	assert.Nil(t, service.Start(job))
+	service.Stop(job.Id)
+	assert.NotNil(t, <-errs)
+}
+
+func TestRateLimitedJobsDoNotHoldWorkers(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	service := GetJobService(JobServiceOptions{Clock: clock, MaxWorkers: 1})
+	service.SetRateLimit("slow", RateLimit{Rate: 1, Burst: 1})
+	slow := []*Job{}
+	for i := 0; i < 3; i++ {
+		job := NewJob(func() (result any, err error) { return nil, nil }, nil)
+		job.Group = "slow"
+		slow = append(slow, job)
+		assert.Nil(t, service.Start(job))
+	}
+	service.Wait(slow[0].Id)
+	assert.Equal(t, JOB_STATUS_QUEUED, service.Status(slow[1].Id))
+
+	other := NewJob(func() (result any, err error) { return nil, nil }, nil)
+	assert.Nil(t, service.Start(other))
+	service.Wait(other.Id)
+	assert.Equal(t, JOB_STATUS_QUEUED, service.Status(slow[1].Id))
+
+	clock.Advance(time.Second)
+	service.Wait(slow[1].Id)
+	clock.Advance(time.Second)
+	service.Wait(slow[2].Id)
+}
+
+func TestStoppedRateLimitedJobReturnsToken(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	service := GetJobService(JobServiceOptions{Clock: clock})
+	service.SetRateLimit("", RateLimit{Rate: 1, Burst: 1})
+	first := NewJob(func() (result any, err error) { return nil, nil }, nil)
+	assert.Nil(t, service.Start(first))
+	service.Wait(first.Id)
+
+	stopped := NewJob(func() (result any, err error) { return nil, nil }, nil)
+	assert.Nil(t, service.Start(stopped))
+	service.Stop(stopped.Id)
+
+	next := NewJob(func() (result any, err error) { return nil, nil }, nil)
+	assert.Nil(t, service.Start(next))
+	clock.Advance(time.Second)
+	service.Wait(next.Id)
+	assert.Equal(t, 0, clock.PendingTimers())
+}
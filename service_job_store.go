@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type JobRecord struct {
+	Id        string    `json:"id"`
+	Type      string    `json:"type"`
+	Payload   []byte    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+	RunAt     time.Time `json:"run_at"`
+}
+
+type JobStore interface {
+	Save(record *JobRecord) error
+	Delete(id string) error
+	List() ([]*JobRecord, error)
+}
+
+type MemoryJobStore struct {
+	_lock    sync.Mutex
+	_records map[string]*JobRecord
+}
+
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{
+		_records: make(map[string]*JobRecord),
+	}
+}
+
+func (store *MemoryJobStore) Save(record *JobRecord) error {
+	if record == nil || record.Id == "" {
+		return fmt.Errorf("job record has no id")
+	}
+	copied := *record
+	store._lock.Lock()
+	defer store._lock.Unlock()
+	store._records[record.Id] = &copied
+	return nil
+}
+
+func (store *MemoryJobStore) Delete(id string) error {
+	store._lock.Lock()
+	defer store._lock.Unlock()
+	delete(store._records, id)
+	return nil
+}
+
+func (store *MemoryJobStore) List() ([]*JobRecord, error) {
+	store._lock.Lock()
+	result := make([]*JobRecord, 0, len(store._records))
+	for _, record := range store._records {
+		copied := *record
+		result = append(result, &copied)
+	}
+	store._lock.Unlock()
+	sortJobRecords(result)
+	return result, nil
+}
+
+// FileJobStore keeps one JSON file per job inside a directory.
+type FileJobStore struct {
+	_dir string
+}
+
+func NewFileJobStore(dir string) (*FileJobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileJobStore{_dir: dir}, nil
+}
+
+func (store *FileJobStore) Save(record *JobRecord) error {
+	if record == nil || record.Id == "" {
+		return fmt.Errorf("job record has no id")
+	}
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return write_file_atomic(store.path(record.Id), content)
+}
+
+func (store *FileJobStore) Delete(id string) error {
+	err := os.Remove(store.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (store *FileJobStore) List() ([]*JobRecord, error) {
+	entries, err := os.ReadDir(store._dir)
+	if err != nil {
+		return nil, err
+	}
+	result := []*JobRecord{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(store._dir, entry.Name()))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		record := &JobRecord{}
+		if err = json.Unmarshal(content, record); err != nil {
+			return nil, fmt.Errorf("corrupt job record '%s': %v", entry.Name(), err)
+		}
+		result = append(result, record)
+	}
+	sortJobRecords(result)
+	return result, nil
+}
+
+func (store *FileJobStore) path(id string) string {
+	return filepath.Join(store._dir, filepath.Base(id)+".json")
+}
+
+func sortJobRecords(records []*JobRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+}
+
+func write_file_atomic(fileName string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), fileName)
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryJobStore(t *testing.T) {
+	store := NewMemoryJobStore()
+	assert.Nil(t, store.Save(&JobRecord{Id: "b", Type: "t", CreatedAt: time.Unix(2, 0)}))
+	assert.Nil(t, store.Save(&JobRecord{Id: "a", Type: "t", CreatedAt: time.Unix(1, 0)}))
+	assert.NotNil(t, store.Save(&JobRecord{}))
+
+	records, err := store.List()
+	assert.Nil(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "a", records[0].Id)
+
+	assert.Nil(t, store.Delete("a"))
+	records, _ = store.List()
+	assert.Len(t, records, 1)
+}
+
+func TestFileJobStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileJobStore(dir)
+	assert.Nil(t, err)
+	assert.Nil(t, store.Save(&JobRecord{Id: "job1", Type: "email", Payload: []byte(`{"to":"a"}`)}))
+
+	reopened, err := NewFileJobStore(dir)
+	assert.Nil(t, err)
+	records, err := reopened.List()
+	assert.Nil(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "email", records[0].Type)
+	assert.Equal(t, `{"to":"a"}`, string(records[0].Payload))
+
+	assert.Nil(t, reopened.Delete("job1"))
+	assert.Nil(t, reopened.Delete("job1"))
+	records, _ = store.List()
+	assert.Empty(t, records)
+}
+
+func TestHandlerJobIsPersistedUntilComplete(t *testing.T) {
+	store := NewMemoryJobStore()
+	service := GetJobService(JobServiceOptions{Store: store})
+	release := make(chan bool)
+	service.RegisterHandler("greet", func(payload []byte) (result any, err error) {
+		<-release
+		var name string
+		err = json.Unmarshal(payload, &name)
+		return "hello " + name, err
+	})
+
+	var result any
+	job, err := NewHandlerJob("greet", "abebe", func(jobId string, res any, err error) {
+		result = res
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, service.Start(job))
+
+	records, _ := store.List()
+	assert.Len(t, records, 1)
+	release <- true
+	service.Wait(job.Id)
+
+	assert.Equal(t, "hello abebe", result)
+	records, _ = store.List()
+	assert.Empty(t, records)
+}
+
+func TestResumeJobsFromStore(t *testing.T) {
+	store, _ := NewFileJobStore(t.TempDir())
+	assert.Nil(t, store.Save(&JobRecord{Id: "left-over", Type: "count", Payload: []byte("3")}))
+
+	service := GetJobService(JobServiceOptions{Store: store})
+	service.RegisterHandler("count", func(payload []byte) (result any, err error) {
+		var n int
+		err = json.Unmarshal(payload, &n)
+		return n + 1, err
+	})
+	var result any
+	ids, err := service.Resume(func(jobId string, res any, err error) {
+		result = res
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"left-over"}, ids)
+	service.Wait("left-over")
+
+	assert.Equal(t, 4, result)
+	records, _ := store.List()
+	assert.Empty(t, records)
+}
+
+func TestResumeKeepsCreatedAt(t *testing.T) {
+	store := NewMemoryJobStore()
+	clock := NewFakeClock(time.Unix(1000, 0))
+	runAt := time.Unix(2000, 0)
+	assert.Nil(t, store.Save(&JobRecord{Id: "old", Type: "noop", CreatedAt: time.Unix(100, 0), RunAt: runAt}))
+
+	service := GetJobService(JobServiceOptions{Store: store, Clock: clock})
+	service.RegisterHandler("noop", func(payload []byte) (result any, err error) { return nil, nil })
+	job, _ := NewHandlerJob("noop", nil, nil)
+	assert.Nil(t, service.StartAt(job, runAt))
+	_, err := service.Resume(nil)
+	assert.Nil(t, err)
+
+	records, _ := store.List()
+	assert.Len(t, records, 2)
+	assert.Equal(t, "old", records[0].Id)
+	assert.Equal(t, time.Unix(100, 0), records[0].CreatedAt)
+	assert.Equal(t, time.Unix(1000, 0), records[1].CreatedAt)
+}
+
+func TestStartJobWithUnknownType(t *testing.T) {
+	service := GetJobService()
+	job, _ := NewHandlerJob("missing", nil, nil)
+	assert.NotNil(t, service.Start(job))
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"testing"
@@ -68,3 +69,46 @@ func TestJobStatus(t *testing.T) {
 	service.Wait(job.Id)
 	assert.Equal(t, JOB_STATUS_COMPLETE, service.Status(job.Id))
 }
+
+func TestShutdownDrainsRunningJobs(t *testing.T) {
+	var service = GetJobService()
+	release := make(chan bool)
+	done := false
+	job := NewJob(func() (result any, err error) {
+		<-release
+		return nil, nil
+	}, func(jobId string, result any, err error) {
+		done = true
+	})
+	assert.Nil(t, service.Start(job))
+
+	go func() { release <- true }()
+	abandoned, err := service.Shutdown(context.Background())
+
+	assert.Nil(t, err)
+	assert.Empty(t, abandoned)
+	assert.True(t, done)
+	assert.Equal(t, ErrJobServiceClosed, service.Start(NewJob(func() (result any, err error) {
+		return nil, nil
+	}, nil)))
+}
+
+func TestShutdownCancelsJobsAfterDeadline(t *testing.T) {
+	var service = GetJobService()
+	cancelled := make(chan error, 1)
+	job := NewContextJob(func(ctx *JobContext) (result any, err error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, func(jobId string, result any, err error) {
+		cancelled <- err
+	})
+	assert.Nil(t, service.Start(job))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	abandoned, err := service.Shutdown(ctx)
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, []string{job.Id}, abandoned)
+	assert.Equal(t, context.Canceled, <-cancelled)
+}
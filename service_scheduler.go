@@ -0,0 +1,404 @@
+package utils
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SCHEDULE_OVERLAP_SKIP = iota
+	SCHEDULE_OVERLAP_QUEUE
+	SCHEDULE_OVERLAP_ALLOW
+)
+
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+type ScheduleOptions struct {
+	Overlap  int
+	Jitter   time.Duration
+	Location *time.Location
+	Callback JobCompleteCallback
+}
+
+type SchedulerOptions struct {
+	Clock Clock
+}
+
+type Scheduler interface {
+	Add(schedule Schedule, action JobAction, options ...ScheduleOptions) (string, error)
+	AddCron(expr string, action JobAction, options ...ScheduleOptions) (string, error)
+	Remove(id string)
+	Next(id string) (time.Time, bool)
+	Stop()
+}
+
+func GetScheduler(jobs JobService, options ...SchedulerOptions) Scheduler {
+	var clock Clock = GetSystemClock()
+	if len(options) > 0 && options[0].Clock != nil {
+		clock = options[0].Clock
+	}
+	return &DefaultScheduler{
+		_jobs:    jobs,
+		_clock:   clock,
+		_entries: make(map[string]*scheduleEntry),
+	}
+}
+
+type DefaultScheduler struct {
+	_lock    sync.Mutex
+	_jobs    JobService
+	_clock   Clock
+	_entries map[string]*scheduleEntry
+}
+
+type scheduleEntry struct {
+	_id       string
+	_schedule Schedule
+	_action   JobAction
+	_options  ScheduleOptions
+	_planned  time.Time
+	_next     time.Time
+	_timer    ClockTimer
+	_running  int
+	_pending  int
+	_removed  bool
+}
+
+func (scheduler *DefaultScheduler) Add(schedule Schedule, action JobAction, options ...ScheduleOptions) (string, error) {
+	if schedule == nil {
+		return "", fmt.Errorf("schedule is nil")
+	} else if action == nil {
+		return "", fmt.Errorf("job action is nil")
+	}
+	entry := &scheduleEntry{
+		_id:       uuid.NewString(),
+		_schedule: schedule,
+		_action:   action,
+	}
+	if len(options) > 0 {
+		entry._options = options[0]
+	}
+	scheduler._lock.Lock()
+	defer scheduler._lock.Unlock()
+	if !scheduler.plan(entry, scheduler._clock.Now()) {
+		return "", fmt.Errorf("schedule has no upcoming run")
+	}
+	scheduler._entries[entry._id] = entry
+	return entry._id, nil
+}
+
+func (scheduler *DefaultScheduler) AddCron(expr string, action JobAction, options ...ScheduleOptions) (string, error) {
+	schedule, err := ParseCron(expr)
+	if err != nil {
+		return "", err
+	}
+	return scheduler.Add(schedule, action, options...)
+}
+
+func (scheduler *DefaultScheduler) Remove(id string) {
+	scheduler._lock.Lock()
+	defer scheduler._lock.Unlock()
+	entry, ok := scheduler._entries[id]
+	if !ok {
+		return
+	}
+	entry._removed = true
+	entry._timer.Stop()
+	delete(scheduler._entries, id)
+}
+
+func (scheduler *DefaultScheduler) Next(id string) (time.Time, bool) {
+	scheduler._lock.Lock()
+	defer scheduler._lock.Unlock()
+	entry, ok := scheduler._entries[id]
+	if !ok {
+		return time.Time{}, false
+	}
+	return entry._next, true
+}
+
+func (scheduler *DefaultScheduler) Stop() {
+	scheduler._lock.Lock()
+	defer scheduler._lock.Unlock()
+	for id, entry := range scheduler._entries {
+		entry._removed = true
+		entry._timer.Stop()
+		delete(scheduler._entries, id)
+	}
+}
+
+// plan arms the timer for the run following `after`. Must hold the lock.
+func (scheduler *DefaultScheduler) plan(entry *scheduleEntry, after time.Time) bool {
+	if entry._options.Location != nil {
+		after = after.In(entry._options.Location)
+	}
+	planned := entry._schedule.Next(after)
+	if planned.IsZero() {
+		return false
+	}
+	next := planned
+	if entry._options.Jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(entry._options.Jitter))))
+	}
+	entry._planned = planned
+	entry._next = next
+	entry._timer = scheduler._clock.AfterFunc(next.Sub(scheduler._clock.Now()), func() {
+		scheduler.fire(entry)
+	})
+	return true
+}
+
+func (scheduler *DefaultScheduler) fire(entry *scheduleEntry) {
+	scheduler._lock.Lock()
+	if entry._removed {
+		scheduler._lock.Unlock()
+		return
+	}
+	run := true
+	if entry._running > 0 {
+		switch entry._options.Overlap {
+		case SCHEDULE_OVERLAP_SKIP:
+			run = false
+		case SCHEDULE_OVERLAP_QUEUE:
+			entry._pending++
+			run = false
+		}
+	}
+	if run {
+		entry._running++
+	}
+	after := entry._planned
+	if now := scheduler._clock.Now(); after.Before(now) {
+		after = now
+	}
+	if !scheduler.plan(entry, after) {
+		delete(scheduler._entries, entry._id)
+	}
+	scheduler._lock.Unlock()
+
+	if run {
+		scheduler.run(entry)
+	}
+}
+
+func (scheduler *DefaultScheduler) run(entry *scheduleEntry) {
+	job := NewJob(entry._action, func(jobId string, result any, err error) {
+		if entry._options.Callback != nil {
+			entry._options.Callback(jobId, result, err)
+		}
+		scheduler.complete(entry)
+	})
+	if err := scheduler._jobs.Start(job); err != nil {
+		if entry._options.Callback != nil {
+			entry._options.Callback(job.Id, nil, err)
+		}
+		scheduler.complete(entry)
+	}
+}
+
+func (scheduler *DefaultScheduler) complete(entry *scheduleEntry) {
+	scheduler._lock.Lock()
+	entry._running--
+	again := entry._pending > 0 && !entry._removed
+	if again {
+		entry._pending--
+		entry._running++
+	}
+	scheduler._lock.Unlock()
+	if again {
+		scheduler.run(entry)
+	}
+}
+
+type intervalSchedule struct {
+	_interval time.Duration
+}
+
+func Every(interval time.Duration) Schedule {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &intervalSchedule{_interval: interval}
+}
+
+func (schedule *intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(schedule._interval)
+}
+
+type cronSchedule struct {
+	_minutes  uint64
+	_hours    uint64
+	_days     uint64
+	_months   uint64
+	_weekDays uint64
+	_anyDay   bool
+	_anyWeek  bool
+	_location *time.Location
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronWeekDayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// ParseCron parses a standard five field cron expression
+// (minute hour day-of-month month day-of-week). Descriptors such as @daily,
+// @every <duration> and a leading CRON_TZ=<zone> are also accepted.
+func ParseCron(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	var location *time.Location
+	if strings.HasPrefix(expr, "CRON_TZ=") || strings.HasPrefix(expr, "TZ=") {
+		parts := strings.SplitN(expr, " ", 2)
+		loc, err := time.LoadLocation(parts[0][strings.Index(parts[0], "=")+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron time zone: %v", err)
+		}
+		location = loc
+		expr = ""
+		if len(parts) > 1 {
+			expr = strings.TrimSpace(parts[1])
+		}
+	}
+	if strings.HasPrefix(expr, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(expr[len("@every "):]))
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid cron interval '%s'", expr)
+		}
+		return Every(interval), nil
+	}
+	if descriptor, ok := cronDescriptors[strings.ToLower(expr)]; ok {
+		expr = descriptor
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression '%s' must have 5 fields", expr)
+	}
+	schedule := &cronSchedule{_location: location}
+	var err error
+	if schedule._minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if schedule._hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if schedule._days, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if schedule._months, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, err
+	}
+	if schedule._weekDays, err = parseCronField(fields[4], 0, 7, cronWeekDayNames); err != nil {
+		return nil, err
+	}
+	if schedule._weekDays&(1<<7) != 0 {
+		schedule._weekDays |= 1
+	}
+	schedule._anyDay = fields[2] == "*" || fields[2] == "?"
+	schedule._anyWeek = fields[4] == "*" || fields[4] == "?"
+	return schedule, nil
+}
+
+func parseCronField(field string, min int, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			parsed, err := strconv.Atoi(part[i+1:])
+			if err != nil || parsed <= 0 {
+				return 0, fmt.Errorf("invalid cron step in '%s'", field)
+			}
+			step = parsed
+			part = part[:i]
+		}
+		low, high := min, max
+		if part != "*" && part != "?" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = parseCronValue(bounds[0], names); err != nil {
+				return 0, fmt.Errorf("invalid cron value in '%s'", field)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = parseCronValue(bounds[1], names); err != nil {
+					return 0, fmt.Errorf("invalid cron value in '%s'", field)
+				}
+			} else if step > 1 {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("cron value out of range in '%s'", field)
+		}
+		for i := low; i <= high; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if named, ok := names[strings.ToLower(value)]; ok {
+		return named, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func (schedule *cronSchedule) Next(after time.Time) time.Time {
+	if schedule._location != nil {
+		after = after.In(schedule._location)
+	}
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if schedule._months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !schedule.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if schedule._hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if schedule._minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (schedule *cronSchedule) matchesDay(t time.Time) bool {
+	day := schedule._days&(1<<uint(t.Day())) != 0
+	weekDay := schedule._weekDays&(1<<uint(t.Weekday())) != 0
+	if schedule._anyDay || schedule._anyWeek {
+		return day && weekDay
+	}
+	return day || weekDay
+}
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func waitSignal(t *testing.T, ch chan int) int {
+	select {
+	case val := <-ch:
+		return val
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for job")
+		return 0
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 2, 30, 0, time.UTC)
+
+	schedule, err := ParseCron("*/5 * * * *")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 5, 0, 0, time.UTC), schedule.Next(start))
+
+	schedule, err = ParseCron("30 9 * * mon-fri")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 1, 1, 9, 30, 0, 0, time.UTC), schedule.Next(start))
+	assert.Equal(t, time.Date(2026, 1, 2, 9, 30, 0, 0, time.UTC), schedule.Next(time.Date(2026, 1, 1, 9, 30, 0, 0, time.UTC)))
+	assert.Equal(t, time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC), schedule.Next(time.Date(2026, 1, 2, 9, 30, 0, 0, time.UTC)))
+
+	schedule, err = ParseCron("@monthly")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), schedule.Next(start))
+
+	schedule, err = ParseCron("@every 90s")
+	assert.Nil(t, err)
+	assert.Equal(t, start.Add(90*time.Second), schedule.Next(start))
+
+	_, err = ParseCron("* * *")
+	assert.NotNil(t, err)
+	_, err = ParseCron("61 * * * *")
+	assert.NotNil(t, err)
+}
+
+func TestParseCronWithTimeZone(t *testing.T) {
+	schedule, err := ParseCron("CRON_TZ=Africa/Addis_Ababa 0 9 * * *")
+	assert.Nil(t, err)
+	next := schedule.Next(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2026, 1, 1, 6, 0, 0, 0, time.UTC), next.UTC())
+}
+
+func TestSchedulerRunsOnCron(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	scheduler := GetScheduler(GetJobService(), SchedulerOptions{Clock: clock})
+	runs := make(chan int, 10)
+	count := 0
+	id, err := scheduler.AddCron("*/5 * * * *", func() (result any, err error) {
+		count++
+		runs <- count
+		return nil, nil
+	})
+	assert.Nil(t, err)
+
+	next, ok := scheduler.Next(id)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 5, 0, 0, time.UTC), next)
+
+	clock.Advance(5 * time.Minute)
+	assert.Equal(t, 1, waitSignal(t, runs))
+	next, _ = scheduler.Next(id)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 10, 0, 0, time.UTC), next)
+
+	scheduler.Remove(id)
+	clock.Advance(time.Hour)
+	_, ok = scheduler.Next(id)
+	assert.False(t, ok)
+	assert.Empty(t, runs)
+}
+
+func TestSchedulerOverlapSkip(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	scheduler := GetScheduler(GetJobService(), SchedulerOptions{Clock: clock})
+	started := make(chan int, 10)
+	done := make(chan int, 10)
+	release := make(chan bool)
+	count := 0
+	_, err := scheduler.Add(Every(time.Minute), func() (result any, err error) {
+		count++
+		started <- count
+		<-release
+		return nil, nil
+	}, ScheduleOptions{
+		Overlap:  SCHEDULE_OVERLAP_SKIP,
+		Callback: func(jobId string, result any, err error) { done <- 1 },
+	})
+	assert.Nil(t, err)
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, 1, waitSignal(t, started))
+	clock.Advance(2 * time.Minute)
+	release <- true
+	waitSignal(t, done)
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, 2, waitSignal(t, started))
+	release <- true
+	waitSignal(t, done)
+}
+
+func TestSchedulerOverlapQueue(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	scheduler := GetScheduler(GetJobService(), SchedulerOptions{Clock: clock})
+	started := make(chan int, 10)
+	release := make(chan bool)
+	count := 0
+	_, err := scheduler.Add(Every(time.Minute), func() (result any, err error) {
+		count++
+		started <- count
+		<-release
+		return nil, nil
+	}, ScheduleOptions{Overlap: SCHEDULE_OVERLAP_QUEUE})
+	assert.Nil(t, err)
+
+	clock.Advance(3 * time.Minute)
+	assert.Equal(t, 1, waitSignal(t, started))
+	release <- true
+	assert.Equal(t, 2, waitSignal(t, started))
+	release <- true
+	assert.Equal(t, 3, waitSignal(t, started))
+	release <- true
+	scheduler.Stop()
+}
+
+func TestSchedulerJitterAndLocation(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	scheduler := GetScheduler(GetJobService(), SchedulerOptions{Clock: clock})
+	loc, err := time.LoadLocation("Africa/Addis_Ababa")
+	assert.Nil(t, err)
+
+	id, err := scheduler.AddCron("0 9 * * *", func() (result any, err error) {
+		return nil, nil
+	}, ScheduleOptions{Location: loc, Jitter: time.Minute})
+	assert.Nil(t, err)
+
+	next, _ := scheduler.Next(id)
+	base := time.Date(2026, 1, 1, 6, 0, 0, 0, time.UTC)
+	assert.False(t, next.Before(base))
+	assert.True(t, next.Before(base.Add(time.Minute)))
+	scheduler.Stop()
+}